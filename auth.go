@@ -0,0 +1,139 @@
+package conflate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HostAuth contains the credentials sent to a host when loading http and https urls, see WithHostAuth.
+// Credentials are only sent to the host they are configured for, including when following redirects.
+type HostAuth struct {
+	// Headers are added to each request
+	Headers map[string]string `json:"headers,omitempty"`
+	// BearerToken, or the token in the BearerTokenEnv environment variable or the BearerTokenFile file, is sent in the Authorization header
+	BearerToken     string `json:"bearer_token,omitempty"`
+	BearerTokenEnv  string `json:"bearer_token_env,omitempty"`
+	BearerTokenFile string `json:"bearer_token_file,omitempty"`
+	// Username and Password, or the password in the PasswordEnv environment variable, are sent using basic auth
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+	// CertFile and KeyFile contain the client certificate and key presented to the host
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// CAFile contains the certificates trusted to verify the host, instead of the system certificates
+	CAFile string `json:"ca_file,omitempty"`
+}
+
+func (a HostAuth) apply(req *http.Request) error {
+	for name, value := range a.Headers {
+		req.Header.Set(name, value)
+	}
+	token, err := a.bearerToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if a.Username != "" {
+		password := a.Password
+		if a.PasswordEnv != "" {
+			password = os.Getenv(a.PasswordEnv)
+		}
+		req.SetBasicAuth(a.Username, password)
+	}
+	return nil
+}
+
+func (a HostAuth) bearerToken() (string, error) {
+	switch {
+	case a.BearerTokenEnv != "":
+		token := os.Getenv(a.BearerTokenEnv)
+		if token == "" {
+			return "", makeError("The bearer token environment variable is not set : %v", a.BearerTokenEnv)
+		}
+		return token, nil
+	case a.BearerTokenFile != "":
+		b, err := os.ReadFile(a.BearerTokenFile)
+		if err != nil {
+			return "", wrapError(err, "Failed to read the bearer token file")
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return a.BearerToken, nil
+}
+
+func (a HostAuth) transport() (http.RoundTripper, error) {
+	if a.CertFile == "" && a.KeyFile == "" && a.CAFile == "" {
+		return defaultHTTPLoader.client.Transport, nil
+	}
+	config := &tls.Config{}
+	if a.CertFile != "" || a.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, wrapError(err, "Failed to load the client certificate %v", a.CertFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if a.CAFile != "" {
+		b, err := os.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, wrapError(err, "Failed to read the CA file")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, makeError("The CA file does not contain any certificates : %v", a.CAFile)
+		}
+	}
+	transport := newTransport()
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+// authTransport adds the credentials of the host of each request, using a transport with the client certificate and CA of the host
+type authTransport struct {
+	auths      map[string]HostAuth
+	mutex      sync.Mutex
+	transports map[string]http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	auth, ok := t.auths[host]
+	if !ok {
+		host = req.URL.Hostname()
+		auth, ok = t.auths[host]
+	}
+	if !ok {
+		return defaultHTTPLoader.client.Transport.RoundTrip(req)
+	}
+	transport, err := t.transport(host, auth)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	err = auth.apply(req)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+func (t *authTransport) transport(host string, auth HostAuth) (http.RoundTripper, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if transport, ok := t.transports[host]; ok {
+		return transport, nil
+	}
+	transport, err := auth.transport()
+	if err != nil {
+		return nil, err
+	}
+	t.transports[host] = transport
+	return transport, nil
+}
@@ -0,0 +1,148 @@
+package conflate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAuthServer(t *testing.T) (*httptest.Server, *[]*http.Request) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testAuthLoad(t *testing.T, server *httptest.Server, options ...Option) error {
+	c := New(options...)
+	u, err := url.Parse(server.URL + "/data.json")
+	assert.Nil(t, err)
+	return c.AddURLs(*u)
+}
+
+func TestHostAuth_HeadersAndTokens(t *testing.T) {
+	server, requests := testAuthServer(t)
+	host := server.Listener.Addr().String()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+	t.Setenv("TEST_BEARER_TOKEN", "env-token")
+	t.Setenv("TEST_PASSWORD", "env-password")
+
+	for _, auth := range []HostAuth{
+		{Headers: map[string]string{"X-Api-Key": "key"}, BearerToken: "token"},
+		{BearerTokenEnv: "TEST_BEARER_TOKEN"},
+		{BearerTokenFile: tokenFile},
+		{Username: "user", PasswordEnv: "TEST_PASSWORD"},
+	} {
+		assert.Nil(t, testAuthLoad(t, server, WithHostAuth(host, auth)))
+	}
+	assert.Equal(t, "key", (*requests)[0].Header.Get("X-Api-Key"))
+	assert.Equal(t, "Bearer token", (*requests)[0].Header.Get("Authorization"))
+	assert.Equal(t, "Bearer env-token", (*requests)[1].Header.Get("Authorization"))
+	assert.Equal(t, "Bearer file-token", (*requests)[2].Header.Get("Authorization"))
+	username, password, ok := (*requests)[3].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "env-password", password)
+}
+
+func TestHostAuth_OtherHosts(t *testing.T) {
+	other, otherRequests := testAuthServer(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		http.Redirect(w, r, other.URL+"/data.json", http.StatusFound)
+	}))
+	defer server.Close()
+	otherURL, err := url.Parse(other.URL)
+	assert.Nil(t, err)
+	// the hosts differ only by port, so the host name alone would match both
+	assert.Nil(t, testAuthLoad(t, server, WithHostAuth(server.Listener.Addr().String(), HostAuth{BearerToken: "token"}), WithHostAuth("example.com", HostAuth{})))
+	assert.Equal(t, 1, len(*otherRequests))
+	assert.Equal(t, "", (*otherRequests)[0].Header.Get("Authorization"))
+	assert.Nil(t, testAuthLoad(t, other, WithHostAuth(otherURL.Hostname(), HostAuth{BearerToken: "token"})))
+	assert.Equal(t, "Bearer token", (*otherRequests)[1].Header.Get("Authorization"))
+}
+
+func TestHostAuth_ErrorsHideCredentials(t *testing.T) {
+	server, _ := testAuthServer(t)
+	err := testAuthLoad(t, server, WithHostAuth(server.Listener.Addr().String(), HostAuth{BearerTokenEnv: "TEST_MISSING_BEARER_TOKEN"}))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The bearer token environment variable is not set : TEST_MISSING_BEARER_TOKEN")
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	u, err := url.Parse(missing.URL + "/missing.json")
+	assert.Nil(t, err)
+	u.User = url.UserPassword("user", "secret")
+	_, err = FromURLs(*u)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Failed to load url : 404")
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func testWritePEM(t *testing.T, path string, blockType string, der []byte) {
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	assert.Nil(t, err)
+}
+
+func TestHostAuth_ClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(certDER)
+	assert.Nil(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"client": "`+r.TLS.PeerCertificates[0].Subject.CommonName+`"}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(cert)
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	auth := HostAuth{CertFile: filepath.Join(dir, "client.crt"), KeyFile: filepath.Join(dir, "client.key"), CAFile: filepath.Join(dir, "ca.crt")}
+	testWritePEM(t, auth.CertFile, "CERTIFICATE", certDER)
+	testWritePEM(t, auth.KeyFile, "PRIVATE KEY", keyDER)
+	testWritePEM(t, auth.CAFile, "CERTIFICATE", server.Certificate().Raw)
+
+	host := server.Listener.Addr().String()
+	assert.NotNil(t, testAuthLoad(t, server, WithHostAuth(host, HostAuth{CAFile: auth.CAFile})))
+	c := New(WithHostAuth(host, auth))
+	u, err := url.Parse(server.URL + "/data.json")
+	assert.Nil(t, err)
+	assert.Nil(t, c.AddURLs(*u))
+	assert.Equal(t, map[string]interface{}{"client": "client"}, c.data)
+
+	err = testAuthLoad(t, server, WithHostAuth(host, HostAuth{CAFile: auth.KeyFile}))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The CA file does not contain any certificates")
+}
@@ -0,0 +1,121 @@
+package conflate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	pkgurl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpCache stores the bodies of http responses in a directory, with the headers needed to revalidate them
+type httpCache struct {
+	dir string
+}
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"`
+}
+
+// newCacheEntry creates the entry for a response, keeping the validators of any previous entry the response does not replace
+func newCacheEntry(url pkgurl.URL, header http.Header, previous *cacheEntry) *cacheEntry {
+	entry := &cacheEntry{URL: url.Redacted(), ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified"), Expires: time.Now()}
+	if previous != nil {
+		if entry.ETag == "" {
+			entry.ETag = previous.ETag
+		}
+		if entry.LastModified == "" {
+			entry.LastModified = previous.LastModified
+		}
+	}
+	if maxAge, ok := cacheControl(header)["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			entry.Expires = entry.Expires.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if _, ok := cacheControl(header)["no-cache"]; ok {
+		entry.Expires = time.Time{}
+	}
+	return entry
+}
+
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+func noStore(header http.Header) bool {
+	_, ok := cacheControl(header)["no-store"]
+	return ok
+}
+
+func (c *httpCache) path(url pkgurl.URL) string {
+	sum := sha256.Sum256([]byte(url.String()))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// read returns the cached entry and body of the url, or a nil entry if the url is not cached
+func (c *httpCache) read(url pkgurl.URL) (*cacheEntry, []byte) {
+	path := c.path(url)
+	b, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(b, &entry) != nil || entry.URL != url.Redacted() {
+		return nil, nil
+	}
+	body, err := os.ReadFile(path + ".body")
+	if err != nil {
+		return nil, nil
+	}
+	return &entry, body
+}
+
+// write stores the entry, and the body unless it is nil
+func (c *httpCache) write(url pkgurl.URL, entry *cacheEntry, body []byte) error {
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		return wrapError(err, "Failed to create the http cache directory")
+	}
+	path := c.path(url)
+	if body != nil {
+		err = writeFileAtomic(path+".body", body)
+		if err != nil {
+			return wrapError(err, "Failed to write the http cache for url %v", url.Redacted())
+		}
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return wrapError(err, "Failed to write the http cache for url %v", url.Redacted())
+	}
+	return wrapError(writeFileAtomic(path+".json", b), "Failed to write the http cache for url %v", url.Redacted())
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
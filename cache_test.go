@@ -0,0 +1,178 @@
+package conflate
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCacheServer struct {
+	*httptest.Server
+	requests []*http.Request
+	handler  func(w http.ResponseWriter, r *http.Request)
+}
+
+func newTestCacheServer(handler func(w http.ResponseWriter, r *http.Request)) *testCacheServer {
+	s := &testCacheServer{handler: handler}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r)
+		s.handler(w, r)
+	}))
+	return s
+}
+
+func (s *testCacheServer) load(t *testing.T, h *httpLoader) ([]byte, error) {
+	u, err := url.Parse(s.URL + "/data.json")
+	assert.Nil(t, err)
+	return h.Load(gocontext.Background(), *u)
+}
+
+func testCachedLoader(t *testing.T) *httpLoader {
+	return &httpLoader{client: defaultHTTPLoader.client, cache: &httpCache{dir: t.TempDir()}}
+}
+
+func TestHTTPCache_MaxAge(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	defer s.Close()
+	h := testCachedLoader(t)
+	for i := 0; i < 2; i++ {
+		data, err := s.load(t, h)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"x": 1}`, string(data))
+	}
+	assert.Equal(t, 1, len(s.requests))
+}
+
+func TestHTTPCache_Revalidate(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	defer s.Close()
+	h := testCachedLoader(t)
+	for i := 0; i < 3; i++ {
+		data, err := s.load(t, h)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"x": 1}`, string(data))
+	}
+	assert.Equal(t, 3, len(s.requests))
+	assert.Equal(t, `"v1"`, s.requests[2].Header.Get("If-None-Match"))
+}
+
+func TestHTTPCache_NoStore(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	defer s.Close()
+	h := testCachedLoader(t)
+	_, err := s.load(t, h)
+	assert.Nil(t, err)
+	_, err = s.load(t, h)
+	assert.Nil(t, err)
+	assert.Equal(t, "", s.requests[1].Header.Get("If-None-Match"))
+}
+
+func TestHTTPCache_StaleOnError(t *testing.T) {
+	status := http.StatusOK
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	h := testCachedLoader(t)
+	_, err := s.load(t, h)
+	assert.Nil(t, err)
+	status = http.StatusBadGateway
+	data, err := s.load(t, h)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"x": 1}`, string(data))
+	status = http.StatusNotFound
+	_, err = s.load(t, h)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Failed to load url : 404")
+	s.Close()
+	data, err = s.load(t, h)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"x": 1}`, string(data))
+}
+
+func TestHTTPCache_Offline(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	defer s.Close()
+	h := testCachedLoader(t)
+	h.offline = true
+	_, err := s.load(t, h)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The url is not in the http cache for the offline mode")
+	h.offline = false
+	_, err = s.load(t, h)
+	assert.Nil(t, err)
+	h.offline = true
+	data, err := s.load(t, h)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"x": 1}`, string(data))
+	assert.Equal(t, 1, len(s.requests))
+	h.cache = nil
+	_, err = s.load(t, h)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The offline mode requires an http cache")
+}
+
+func TestHTTPCache_Unwritable(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	defer s.Close()
+	dir := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dir, nil, 0o644)
+	assert.Nil(t, err)
+	h := &httpLoader{client: defaultHTTPLoader.client, cache: &httpCache{dir: dir}}
+	data, err := s.load(t, h)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"x": 1}`, string(data))
+}
+
+func TestCacheEntry(t *testing.T) {
+	u := url.URL{Scheme: "http", Host: "host"}
+	header := http.Header{"Cache-Control": {`max-age="10", private`}}
+	entry := newCacheEntry(u, header, &cacheEntry{ETag: "e", LastModified: "l"})
+	assert.Equal(t, "e", entry.ETag)
+	assert.Equal(t, "l", entry.LastModified)
+	assert.True(t, entry.Expires.After(time.Now().Add(9*time.Second)))
+	assert.Equal(t, map[string]string{"max-age": "10", "private": ""}, cacheControl(header))
+}
+
+func TestConflate_WithHTTPCache(t *testing.T) {
+	s := newTestCacheServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"x": 1}`)
+	})
+	dir := t.TempDir()
+	c := New(WithHTTPCache(dir))
+	err := c.AddData([]byte(fmt.Sprintf(`{"includes": ["%v/data.json"]}`, s.URL)))
+	assert.Nil(t, err)
+	s.Close()
+	c = New(WithHTTPCache(dir), WithOffline(true))
+	err = c.AddData([]byte(fmt.Sprintf(`{"includes": ["%v/data.json"]}`, s.URL)))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": int64(1)}, c.data)
+}
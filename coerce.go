@@ -0,0 +1,163 @@
+package conflate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Coercion defines how a source value is converted when its type differs from the type of the destination value
+type Coercion string
+
+const (
+	// CoerceStrict does not convert values, so the types must be the same
+	CoerceStrict Coercion = "strict"
+	// CoerceNumeric converts numbers of different types, widening integers to floats where either value is a float
+	CoerceNumeric Coercion = "numeric"
+	// CoerceString additionally parses strings as the type of a destination number or boolean
+	CoerceString Coercion = "string"
+	// CoerceSchema converts values to the type defined for their path in the schema, see WithCoercionSchema.
+	// Values at paths without a single defined type are coerced as CoerceNumeric.
+	CoerceSchema Coercion = "schema"
+)
+
+// coerce converts the source value for merging into the destination value, returning false if it cannot be converted
+func (m *merger) coerce(ctx context, toData interface{}, fromData interface{}) (interface{}, bool, error) {
+	switch m.coercion {
+	case "", CoerceStrict:
+		return nil, false, nil
+	case CoerceNumeric:
+		return coerceNumber(toData, fromData)
+	case CoerceString:
+		if s, ok := fromData.(string); ok {
+			return parseScalar(reflect.ValueOf(toData).Kind(), s)
+		}
+		return coerceNumber(toData, fromData)
+	case CoerceSchema:
+		if m.coercionSchema == nil {
+			return nil, false, makeContextError(ctx, "The schema coercion requires a schema")
+		}
+		if schemaType := m.coercionSchema.typeAt(ctx); schemaType != "" {
+			return coerceSchemaType(schemaType, fromData)
+		}
+		return coerceNumber(toData, fromData)
+	}
+	return nil, false, makeContextError(ctx, "Unknown coercion (%v)", m.coercion)
+}
+
+func coerceNumber(toData interface{}, fromData interface{}) (interface{}, bool, error) {
+	toKind := reflect.ValueOf(toData).Kind()
+	fromVal := reflect.ValueOf(fromData)
+	if !isNumberKind(toKind) || !isNumberKind(fromVal.Kind()) {
+		return nil, false, nil
+	}
+	if isFloatKind(toKind) || isFloatKind(fromVal.Kind()) {
+		return fromVal.Convert(reflect.TypeOf(float64(0))).Interface(), true, nil
+	}
+	return fromVal.Convert(reflect.TypeOf(int64(0))).Interface(), true, nil
+}
+
+func coerceSchemaType(schemaType string, fromData interface{}) (interface{}, bool, error) {
+	fromVal := reflect.ValueOf(fromData)
+	switch {
+	case schemaType == "string":
+		return fmt.Sprint(fromData), true, nil
+	case fromVal.Kind() == reflect.String:
+		kinds := map[string]reflect.Kind{"integer": reflect.Int64, "number": reflect.Float64, "boolean": reflect.Bool}
+		if kind, ok := kinds[schemaType]; ok {
+			return parseScalar(kind, fromVal.String())
+		}
+	case schemaType == "number" && isNumberKind(fromVal.Kind()):
+		return fromVal.Convert(reflect.TypeOf(float64(0))).Interface(), true, nil
+	case schemaType == "integer" && isNumberKind(fromVal.Kind()):
+		i := fromVal.Convert(reflect.TypeOf(int64(0))).Interface()
+		if reflect.ValueOf(i).Convert(fromVal.Type()).Interface() != fromData {
+			return nil, false, makeError("The value %v is not an integer", fromData)
+		}
+		return i, true, nil
+	}
+	return nil, false, nil
+}
+
+func parseScalar(kind reflect.Kind, s string) (interface{}, bool, error) {
+	var out interface{}
+	var err error
+	switch {
+	case kind == reflect.Bool:
+		out, err = strconv.ParseBool(s)
+	case isFloatKind(kind):
+		out, err = strconv.ParseFloat(s, 64)
+	case isNumberKind(kind):
+		out, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			out, err = strconv.ParseFloat(s, 64)
+		}
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, wrapError(err, "Could not coerce the value '%v'", s)
+	}
+	return out, true, nil
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return (kind >= reflect.Int && kind <= reflect.Uint64) || isFloatKind(kind)
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// equalValues reports whether the values are deeply equal, comparing numbers by value, so that the same number decoded
+// from different formats, e.g. an int from yaml and an int64 from json, is equal
+func equalValues(a interface{}, b interface{}) bool {
+	aVal, bVal := reflect.ValueOf(a), reflect.ValueOf(b)
+	if isNumberKind(aVal.Kind()) && isNumberKind(bVal.Kind()) {
+		return equalNumbers(aVal, bVal)
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, aProp := range a {
+			bProp, ok := b[name]
+			if !ok || !equalValues(aProp, bProp) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equalValues(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func equalNumbers(a reflect.Value, b reflect.Value) bool {
+	switch {
+	case isFloatKind(a.Kind()) || isFloatKind(b.Kind()):
+		return a.Convert(reflect.TypeOf(float64(0))).Float() == b.Convert(reflect.TypeOf(float64(0))).Float()
+	case isUintKind(a.Kind()) && isUintKind(b.Kind()):
+		return a.Uint() == b.Uint()
+	case isUintKind(a.Kind()):
+		return b.Int() >= 0 && uint64(b.Int()) == a.Uint()
+	case isUintKind(b.Kind()):
+		return a.Int() >= 0 && uint64(a.Int()) == b.Uint()
+	}
+	return a.Int() == b.Int()
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uint64
+}
@@ -0,0 +1,96 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCoerceMerge(coercion Coercion, schema *Schema, toData, fromData interface{}) (interface{}, error) {
+	m := &merger{coercion: coercion, coercionSchema: schema}
+	err := m.mergeTo(&toData, fromData)
+	return toData, err
+}
+
+func TestCoerce_Strict(t *testing.T) {
+	_, err := testCoerceMerge(CoerceStrict, nil, int64(1), 1.5)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The destination type (int64) must be the same as the source type (float64)")
+}
+
+func TestCoerce_Numeric(t *testing.T) {
+	data, err := testCoerceMerge(CoerceNumeric, nil, int64(1), 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, data)
+	data, err = testCoerceMerge(CoerceNumeric, nil, 1.5, int64(2))
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, data)
+	data, err = testCoerceMerge(CoerceNumeric, nil, int64(1), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), data)
+	_, err = testCoerceMerge(CoerceNumeric, nil, int64(1), "2")
+	assert.NotNil(t, err)
+}
+
+func TestCoerce_String(t *testing.T) {
+	data, err := testCoerceMerge(CoerceString, nil, map[string]interface{}{"a": int64(1), "b": 1.5, "c": true},
+		map[string]interface{}{"a": "2", "b": "2.5", "c": "false"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": int64(2), "b": 2.5, "c": false}, data)
+	data, err = testCoerceMerge(CoerceString, nil, int64(1), 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, data)
+	_, err = testCoerceMerge(CoerceString, nil, int64(1), "x")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not coerce the value 'x'")
+	_, err = testCoerceMerge(CoerceString, nil, "x", int64(1))
+	assert.NotNil(t, err)
+}
+
+func TestCoerce_Schema(t *testing.T) {
+	schema, err := NewSchemaData([]byte(`{
+		"type": "object",
+		"definitions": {"port": {"type": "string"}},
+		"properties": {
+			"port": {"$ref": "#/definitions/port"},
+			"ratio": {"type": "number"},
+			"count": {"type": "integer"},
+			"list": {"type": "array", "items": {"type": "boolean"}}
+		}
+	}`))
+	assert.Nil(t, err)
+	data, err := testCoerceMerge(CoerceSchema, schema,
+		map[string]interface{}{"port": "8080", "ratio": int64(1), "count": int64(1), "other": int64(1)},
+		map[string]interface{}{"port": int64(8081), "ratio": "1.5", "count": 2.0, "other": 1.5})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"port": "8081", "ratio": 1.5, "count": int64(2), "other": 1.5}, data)
+	assert.Equal(t, "boolean", schema.typeAt(rootContext().add("list").addInt(1)))
+	assert.Equal(t, "", schema.typeAt(rootContext().add("other")))
+	_, err = testCoerceMerge(CoerceSchema, schema, map[string]interface{}{"count": int64(1)}, map[string]interface{}{"count": 2.5})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The value 2.5 is not an integer")
+}
+
+func TestCoerce_SchemaNotSet(t *testing.T) {
+	_, err := testCoerceMerge(CoerceSchema, nil, int64(1), 1.5)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The schema coercion requires a schema")
+}
+
+func TestCoerce_Unknown(t *testing.T) {
+	_, err := testCoerceMerge("bad", nil, int64(1), 1.5)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown coercion (bad)")
+}
+
+func TestEqualValues(t *testing.T) {
+	assert.True(t, equalValues(8080, int64(8080)))
+	assert.True(t, equalValues(uint64(1), int64(1)))
+	assert.True(t, equalValues(1.0, 1))
+	assert.True(t, equalValues(map[string]interface{}{"l": []interface{}{1, "a"}}, map[string]interface{}{"l": []interface{}{int64(1), "a"}}))
+	assert.False(t, equalValues(-1, uint64(1)))
+	assert.False(t, equalValues(1.5, 1))
+	assert.False(t, equalValues("1", 1))
+	assert.False(t, equalValues(map[string]interface{}{"a": 1}, map[string]interface{}{"b": 1}))
+	assert.False(t, equalValues([]interface{}{1}, []interface{}{1, 2}))
+}
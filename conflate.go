@@ -1,31 +1,86 @@
 package conflate
 
 import (
+	gocontext "context"
+	"io/fs"
 	"net/url"
+	"os"
+	"strings"
 )
 
 // Includes is used to specify the top level key that holds the includes array
 var Includes = "includes"
 
+// DeleteDirective is used to specify the key that deletes a value, e.g. {"feature": {"$delete": true}}. A blank string disables the directive.
+var DeleteDirective = "$delete"
+
+// ReplaceDirective is used to specify the key that replaces a value instead of merging it, e.g. {"feature": {"$replace": {"enabled": false}}}. A blank string disables the directive.
+var ReplaceDirective = "$replace"
+
+// StrategyDirective is used to specify the key that sets the array merge strategy of a value and any values nested within it, e.g. {"hosts": {"$strategy": "replace", "$merge": ["prod"]}}. A blank string disables the directive.
+var StrategyDirective = "$strategy"
+
+// MergeDirective is used to specify the key that holds the value to merge alongside a StrategyDirective. If missing, the remaining keys of the object are merged. A blank string disables the directive.
+var MergeDirective = "$merge"
+
+// DefaultConcurrency is the number of urls fetched at once by a Conflate instance, unless set by WithConcurrency
+var DefaultConcurrency = 8
+
 // Conflate contains a 'working' merged data set and optionally a JSON v4 schema
 type Conflate struct {
-	data   interface{}
-	loader loader
+	data       interface{}
+	loader     loader
+	merger     merger
+	provenance provenance
+	conflicts  []Conflict
+	fsys       fsHandler
+	fsDir      string
+	http       *httpLoader
+	graph      []*IncludeNode
 }
 
-// New constructs a new empty Conflate instance
-func New() *Conflate {
-	return &Conflate{
+// New constructs a new empty Conflate instance, configured with the given options
+func New(options ...Option) *Conflate {
+	c := &Conflate{
 		loader: loader{
 			newFiledata: newFiledata,
+			workers:     newWorkers(DefaultConcurrency),
+			digests:     newDigests(),
 		},
+		provenance: make(provenance),
+	}
+	c.merger.provenance = c.provenance
+	c.merger.conflicts = &c.conflicts
+	for _, option := range options {
+		option(c)
 	}
+	return c
 }
 
 // FromFiles constructs a new Conflate instance populated with the data from the given files
 func FromFiles(paths ...string) (*Conflate, error) {
+	return FromFilesContext(gocontext.Background(), paths...)
+}
+
+// FromFilesContext constructs a new Conflate instance populated with the data from the given files, loading them with the context
+func FromFilesContext(ctx gocontext.Context, paths ...string) (*Conflate, error) {
 	c := New()
-	err := c.AddFiles(paths...)
+	err := c.AddFilesContext(ctx, paths...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FromFS constructs a new Conflate instance populated with the data from the given files in the file system
+func FromFS(fsys fs.FS, paths ...string) (*Conflate, error) {
+	return FromFSContext(gocontext.Background(), fsys, paths...)
+}
+
+// FromFSContext constructs a new Conflate instance populated with the data from the given files in the file system, loading them with the context
+func FromFSContext(ctx gocontext.Context, fsys fs.FS, paths ...string) (*Conflate, error) {
+	c := New()
+	err := c.AddFSContext(ctx, fsys, paths...)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +89,13 @@ func FromFiles(paths ...string) (*Conflate, error) {
 
 // FromURLs constructs a new Conflate instance populated with the data from the given URLs
 func FromURLs(urls ...url.URL) (*Conflate, error) {
+	return FromURLsContext(gocontext.Background(), urls...)
+}
+
+// FromURLsContext constructs a new Conflate instance populated with the data from the given URLs, loading them with the context
+func FromURLsContext(ctx gocontext.Context, urls ...url.URL) (*Conflate, error) {
 	c := New()
-	err := c.AddURLs(urls...)
+	err := c.AddURLsContext(ctx, urls...)
 	if err != nil {
 		return nil, err
 	}
@@ -44,8 +104,13 @@ func FromURLs(urls ...url.URL) (*Conflate, error) {
 
 // FromData constructs a new Conflate instance populated with the given data
 func FromData(data ...[]byte) (*Conflate, error) {
+	return FromDataContext(gocontext.Background(), data...)
+}
+
+// FromDataContext constructs a new Conflate instance populated with the given data, loading any includes with the context
+func FromDataContext(ctx gocontext.Context, data ...[]byte) (*Conflate, error) {
 	c := New()
-	err := c.AddData(data...)
+	err := c.AddDataContext(ctx, data...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,8 +119,13 @@ func FromData(data ...[]byte) (*Conflate, error) {
 
 // FromGo constructs a new Conflate instance populated with the given golang objects
 func FromGo(data ...interface{}) (*Conflate, error) {
+	return FromGoContext(gocontext.Background(), data...)
+}
+
+// FromGoContext constructs a new Conflate instance populated with the given golang objects, loading any includes with the context
+func FromGoContext(ctx gocontext.Context, data ...interface{}) (*Conflate, error) {
 	c := New()
-	err := c.AddGo(data...)
+	err := c.AddGoContext(ctx, data...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,40 +141,166 @@ func (c *Conflate) Expand(expand bool) {
 	}
 }
 
-// AddFiles recursively merges the data from the given files into the Conflate instance
+// AddFiles recursively merges the data from the given files into the Conflate instance.
+// A glob pattern, e.g. "conf.d/*.yaml", or a directory, adds the matching data files in lexical order, as do includes.
 func (c *Conflate) AddFiles(paths ...string) error {
+	return c.AddFilesContext(gocontext.Background(), paths...)
+}
+
+// AddFilesContext recursively merges the data from the given files into the Conflate instance, loading them with the context
+func (c *Conflate) AddFilesContext(ctx gocontext.Context, paths ...string) error {
 	urls, err := toURLs(nil, paths...)
 	if err != nil {
 		return err
 	}
-	return c.AddURLs(urls...)
+	return c.AddURLsContext(ctx, urls...)
+}
+
+// AddFS recursively merges the data from the given files in the file system into the Conflate instance.
+// Relative includes are loaded from the same file system, see WithFSFallthrough to load missing files from a directory.
+func (c *Conflate) AddFS(fsys fs.FS, paths ...string) error {
+	return c.AddFSContext(gocontext.Background(), fsys, paths...)
+}
+
+// AddFSContext recursively merges the data from the given files in the file system into the Conflate instance, loading them with the context
+func (c *Conflate) AddFSContext(ctx gocontext.Context, fsys fs.FS, paths ...string) error {
+	if c.fsDir != "" {
+		fsys = fallthroughFS{first: fsys, second: os.DirFS(c.fsDir)}
+	}
+	root := c.fsys.add(fsys)
+	c.RegisterScheme(fsScheme, &c.fsys)
+	urls, err := toURLs(&root, paths...)
+	if err != nil {
+		return err
+	}
+	return c.AddURLsContext(ctx, urls...)
 }
 
 // AddURLs recursively merges the data from the given urls into the Conflate instance
 func (c *Conflate) AddURLs(urls ...url.URL) error {
-	data, err := c.loader.loadURLsRecursive(nil, urls...)
+	return c.AddURLsContext(gocontext.Background(), urls...)
+}
+
+// AddURLsContext recursively merges the data from the given urls into the Conflate instance, loading them with the context.
+// Loading stops with an error when the context is cancelled or its deadline is exceeded.
+func (c *Conflate) AddURLsContext(ctx gocontext.Context, urls ...url.URL) error {
+	urls, err := c.loader.expandURLs(nil, urls)
+	if err != nil {
+		return err
+	}
+	root := &IncludeNode{Depth: -1}
+	data, err := c.loader.loadURLsRecursive(ctx, root, urls...)
 	if err != nil {
 		return err
 	}
+	c.graph = append(c.graph, root.Includes...)
 	return c.mergeData(data...)
 }
 
 // AddGo recursively merges the given (json-serializable) golang objects into the Conflate instance
 func (c *Conflate) AddGo(objs ...interface{}) error {
+	return c.AddGoContext(gocontext.Background(), objs...)
+}
+
+// AddGoContext recursively merges the given (json-serializable) golang objects into the Conflate instance, loading any includes with the context
+func (c *Conflate) AddGoContext(ctx gocontext.Context, objs ...interface{}) error {
 	data, err := jsonMarshalAll(objs...)
 	if err != nil {
 		return err
 	}
-	return c.AddData(data...)
+	return c.AddDataContext(ctx, data...)
 }
 
 // AddData recursively merges the given data into the Conflate instance
 func (c *Conflate) AddData(data ...[]byte) error {
+	return c.AddDataContext(gocontext.Background(), data...)
+}
+
+// AddDataContext recursively merges the given data into the Conflate instance, loading any includes with the context
+func (c *Conflate) AddDataContext(ctx gocontext.Context, data ...[]byte) error {
 	fdata, err := c.loader.wrapFiledatas(data...)
 	if err != nil {
 		return err
 	}
-	return c.addData(fdata...)
+	return c.addData(ctx, fdata...)
+}
+
+// RegisterScheme loads the includes and urls of the given scheme, e.g. "s3", using the handler.
+// The handler replaces any built-in handler for the file, http and https schemes.
+func (c *Conflate) RegisterScheme(scheme string, h SchemeHandler) {
+	if c.loader.handlers == nil {
+		c.loader.handlers = make(map[string]SchemeHandler)
+	}
+	c.loader.handlers[scheme] = h
+}
+
+// httpLoader returns the loader of http and https urls configured by the options of the Conflate instance
+func (c *Conflate) httpLoader() *httpLoader {
+	if c.http == nil {
+		c.http = &httpLoader{client: defaultHTTPLoader.client}
+		c.RegisterScheme("http", c.http)
+		c.RegisterScheme("https", c.http)
+	}
+	return c.http
+}
+
+// ApplyMergePatch applies the given RFC 7386 JSON Merge Patch to the data
+func (c *Conflate) ApplyMergePatch(patch []byte) error {
+	var p interface{}
+	err := JSONUnmarshal(patch, &p)
+	if err != nil {
+		return wrapError(err, "Could not unmarshal merge patch")
+	}
+	c.applyMergePatch(newSourceMap(filedata{data: patch}), p)
+	return nil
+}
+
+// ApplyJSONPatch applies the given RFC 6902 JSON Patch to the data. The data is left unchanged if any operation fails.
+func (c *Conflate) ApplyJSONPatch(patch []byte) error {
+	var ops []interface{}
+	err := JSONUnmarshal(patch, &ops)
+	if err != nil {
+		return wrapError(err, "Could not unmarshal json patch")
+	}
+	return c.applyJSONPatch(newSourceMap(filedata{data: patch}), ops)
+}
+
+// ApplyPatchFiles applies the patches in the given files to the data, in order. The files are unmarshalled according to their
+// extension, and applied as a JSON Patch when they contain an array, and otherwise as a JSON Merge Patch. The files are verified,
+// and their includes are merged before them, like any other file, see WithTrustedKeys and WithLock.
+func (c *Conflate) ApplyPatchFiles(paths ...string) error {
+	return c.ApplyPatchFilesContext(gocontext.Background(), paths...)
+}
+
+// ApplyPatchFilesContext applies the patches in the given files to the data, loading them, and any files they include, with the context
+func (c *Conflate) ApplyPatchFilesContext(ctx gocontext.Context, paths ...string) error {
+	urls, err := toURLs(nil, paths...)
+	if err != nil {
+		return err
+	}
+	root := &IncludeNode{Depth: -1}
+	data, err := c.loader.loadPatchURLsRecursive(ctx, root, urls...)
+	if err != nil {
+		return err
+	}
+	c.graph = append(c.graph, root.Includes...)
+	return c.mergeData(data...)
+}
+
+// Provenance returns the sources that set, overrode or deleted the value at the given path, e.g. "#/parent/child", in merge order.
+// Array items are attributed to the sources of their array, unless the array is merged by key.
+func (c *Conflate) Provenance(path string) []Source {
+	return c.provenance.get(rootContext().add(strings.TrimPrefix(path, "#")))
+}
+
+// Conflicts returns the values that were overridden by a different source, when using the StrictWarn mode
+func (c *Conflate) Conflicts() []Conflict {
+	return c.conflicts
+}
+
+// Lock returns the digests of the data loaded from remote urls, including the urls of includes, for use with WithLock
+func (c *Conflate) Lock() Lock {
+	return c.loader.digests.copy()
 }
 
 // ApplyDefaults sets any nil or missing values in the data, to the default values defined in the JSON v4 schema
@@ -137,15 +333,52 @@ func (c *Conflate) MarshalTOML() ([]byte, error) {
 	return tomlMarshal(c.data)
 }
 
-func (c *Conflate) addData(fdata ...filedata) error {
-	fdata, err := c.loader.loadDataRecursive(nil, fdata...)
+func (c *Conflate) addData(ctx gocontext.Context, fdata ...filedata) error {
+	root := &IncludeNode{Depth: -1}
+	fdata, err := c.loader.loadDataRecursive(ctx, root, fdata...)
 	if err != nil {
 		return err
 	}
+	c.graph = append(c.graph, root.Includes...)
 	return c.mergeData(fdata...)
 }
 
 func (c *Conflate) mergeData(fdata ...filedata) error {
-	doms := filedatas(fdata).objs()
-	return mergeTo(&c.data, doms...)
+	defer func() { c.merger.source = nil }()
+	for _, fd := range fdata {
+		var err error
+		fd = fd.mounted()
+		sm := newSourceMap(fd)
+		switch fd.patch {
+		case mergePatchKind:
+			c.applyMergePatch(sm, fd.obj)
+		case jsonPatchKind:
+			err = c.applyJSONPatch(sm, fd.ops)
+		default:
+			c.merger.source = sm
+			err = c.merger.merge(&c.data, fd.obj)
+		}
+		if err != nil {
+			return fd.wrapError(err)
+		}
+	}
+	return nil
+}
+
+func (c *Conflate) applyMergePatch(sm *sourceMap, patch interface{}) {
+	c.data = mergePatch(c.data, patch)
+	c.provenance.addValue(rootContext(), sm, patch)
+}
+
+func (c *Conflate) applyJSONPatch(sm *sourceMap, ops []interface{}) error {
+	data, err := jsonPatch(c.data, ops)
+	if err != nil {
+		return err
+	}
+	c.data = data
+	for _, op := range ops {
+		path, _ := pointerField(op.(map[string]interface{}), "path")
+		c.provenance.addPointer(sm, data, path)
+	}
+	return nil
 }
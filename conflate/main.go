@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"github.com/miracl/conflate"
@@ -11,6 +17,61 @@ import (
 
 var version = "devel"
 
+var commands = []struct{ usage, description string }{
+	{"diff", "List the values added, removed and replaced in the -data files compared against the -against files"},
+	{"explain <path>", "List the sources that set the value at the given path, e.g. '#/parent/child'"},
+	{"graph", "Write the files included by the -data files, in merge order, as a dot graph, or as JSON with '-format json'"},
+	{"lock", "Write the sha256 digests of the remote urls loaded by the -data files, and their includes, to the -lock file as JSON"},
+	{"merge3 <base> <ours> <theirs>", "Merge the changes made to the base file by ours and theirs, writing any conflicts to standard error as JSON"},
+}
+
+var (
+	data            listFlag
+	against         listFlag
+	patches         listFlag
+	arrayMergePaths listFlag
+	arrayMergeKeys  listFlag
+	allowSchemes    listFlag
+	allowHosts      listFlag
+	allowRoots      listFlag
+	trustedKeys     listFlag
+	schemaFile      = flag.String("schema", "", "The path/url of a JSON v4 schema file")
+	defaults        = flag.Bool("defaults", false, "Apply defaults from schema to data")
+	validate        = flag.Bool("validate", false, "Validate the data against the schema")
+	format          = flag.String("format", "", "Output format of the data JSON/YAML/TOML")
+	includes        = flag.String("includes", "includes", "Name of includes array. Blank string suppresses expansion of includes arrays")
+	noincludes      = flag.Bool("noincludes", false, "Switches off conflation of includes. Overrides any --includes setting.")
+	expand          = flag.Bool("expand", false, "Expand environment variables in files")
+	arrayMerge      = flag.String("arraymerge", "append", "Strategy used to merge arrays append/prepend/replace/union")
+	strict          = flag.String("strict", "off", "Report values overridden by a different file off/warn/error")
+	concurrency     = flag.Int("concurrency", conflate.DefaultConcurrency, "The number of urls fetched at once, where sibling includes are fetched in parallel but still merged in order")
+	authFile        = flag.String("auth", "", "The path of a JSON/YAML file of the credentials sent to each host when loading http/https urls")
+	cacheDir        = flag.String("cache", "", "The directory used to cache the data loaded from http/https urls")
+	dedupe          = flag.String("dedupe", "off", "Merge a url that is included more than once off/first/last, where first and last merge it only at its first or last occurrence")
+	maxDepth        = flag.Int("maxdepth", 0, "The maximum depth of includes below the -data files. Zero means no limit")
+	maxFiles        = flag.Int("maxfiles", 0, "The maximum number of files loaded by each -data file, including includes. Zero means no limit")
+	lockFile        = flag.String("lock", "", "The path of a JSON/YAML file of the sha256 digests that the data loaded from remote urls must match, which is written by the lock command")
+	globRequired    = flag.Bool("globrequired", false, "Fail for an include, or -data file, that is a glob pattern or directory matching no files")
+	offline         = flag.Bool("offline", false, "Load http/https urls only from the -cache directory")
+	coerce          = flag.String("coerce", "strict", "Convert merged values of different types strict/numeric/string/schema, where schema uses the types in the -schema file")
+	diffFormat      = flag.String("diffformat", "text", "Output format of the diff command text/json/patch, where patch is a JSON patch (RFC 6902) changing the -against data into the -data data")
+	timeout         = flag.Duration("timeout", 0, "The maximum time to load the data, includes and schema, e.g. '10s'. Zero means no limit")
+	showVersion     = flag.Bool("version", false, "Display the version number")
+)
+
+func init() {
+	flag.Var(&data, "data", "The path/url of JSON/YAML/TOML data, or 'stdin' to read from standard input")
+	flag.Var(&against, "against", "The path/url of JSON/YAML/TOML data compared against by the diff command")
+	flag.Var(&patches, "patch", "The path of a JSON merge patch (RFC 7386) or JSON patch (RFC 6902) file applied after the data, or 'stdin' to read from standard input")
+	flag.Var(&arrayMergePaths, "arraymergepath", "A pattern=strategy pair setting the array merge strategy for matching paths, e.g. '#/allowed_hosts=replace'")
+	flag.Var(&arrayMergeKeys, "arraymergekey", "A pattern=key pair merging the objects in arrays at matching paths by the given key field, e.g. '#/services=name'")
+	flag.Var(&allowSchemes, "allowscheme", "A url scheme that includes are restricted to, e.g. 'file' or 'https'")
+	flag.Var(&allowHosts, "allowhost", "A host that includes, and redirects, are restricted to, e.g. 'config.example.com' or '*.example.com'")
+	flag.Var(&allowRoots, "allowroot", "A directory that included files are restricted to")
+	flag.Var(&trustedKeys, "trustedkey", "The path of a PEM or base64 encoded ed25519 public key, where each loaded file must have a '.sig' signature from a trusted key")
+	flag.Usage = usage
+}
+
 func failIfError(err error) {
 	if err != nil {
 		fmt.Println(err)
@@ -18,20 +79,18 @@ func failIfError(err error) {
 	}
 }
 
-func main() {
-
-	var data dataFlag
-	flag.Var(&data, "data", "The path/url of JSON/YAML/TOML data, or 'stdin' to read from standard input")
-	schemaFile := flag.String("schema", "", "The path/url of a JSON v4 schema file")
-	defaults := flag.Bool("defaults", false, "Apply defaults from schema to data")
-	validate := flag.Bool("validate", false, "Validate the data against the schema")
-	format := flag.String("format", "", "Output format of the data JSON/YAML/TOML")
-	includes := flag.String("includes", "includes", "Name of includes array. Blank string suppresses expansion of includes arrays")
-	noincludes := flag.Bool("noincludes", false, "Switches off conflation of includes. Overrides any --includes setting.")
-	expand := flag.Bool("expand", false, "Expand environment variables in files")
-	showVersion := flag.Bool("version", false, "Display the version number")
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of conflate:\n  conflate [command] [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(out, "  %v\n    \t%v\n", command.usage, command.description)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	flag.Parse()
+func main() {
+	command := parseArgs(os.Args[1:])
 
 	if *showVersion {
 		fmt.Println(version)
@@ -43,8 +102,155 @@ func main() {
 		conflate.Includes = ""
 	}
 
-	c := conflate.New()
+	switch command {
+	case "":
+		output(load(data))
+	case "explain":
+		explain(load(data), flag.Arg(0))
+	case "diff":
+		if len(against) == 0 {
+			failIfError(fmt.Errorf("The diff command requires the -against data"))
+		}
+		diff(load(data), load(against))
+	case "merge3":
+		merge3(flag.Args())
+	case "lock":
+		lock(data)
+	case "graph":
+		graph(load(data))
+	default:
+		failIfError(fmt.Errorf("Unknown command : %v", command))
+	}
+}
+
+func parseArgs(args []string) string {
+	var command string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	failIfError(flag.CommandLine.Parse(args))
+	return command
+}
+
+func loadContext() (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(context.Background(), *timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func options() []conflate.Option {
+	options := []conflate.Option{
+		conflate.WithArrayMerge(conflate.ArrayMerge(*arrayMerge)),
+		conflate.WithStrict(conflate.StrictMode(*strict)),
+		conflate.WithCoercion(conflate.Coercion(*coerce)),
+		conflate.WithConcurrency(*concurrency),
+		conflate.WithDedupe(conflate.Dedupe(*dedupe)),
+		conflate.WithMaxIncludeDepth(*maxDepth),
+		conflate.WithMaxFiles(*maxFiles),
+	}
+	if *cacheDir != "" {
+		options = append(options, conflate.WithHTTPCache(*cacheDir))
+	}
+	if *globRequired {
+		options = append(options, conflate.WithGlobMatchRequired(true))
+	}
+	if *offline {
+		options = append(options, conflate.WithOffline(true))
+	}
+	if len(allowSchemes) > 0 || len(allowHosts) > 0 || len(allowRoots) > 0 {
+		options = append(options, conflate.WithIncludePolicy(conflate.IncludePolicy{Schemes: allowSchemes, Hosts: allowHosts, Roots: allowRoots}))
+	}
+	if len(trustedKeys) > 0 {
+		options = append(options, conflate.WithTrustedKeys(loadTrustedKeys()...))
+	}
+	if *lockFile != "" {
+		options = append(options, conflate.WithLock(loadLock()))
+	}
+	for host, auth := range loadAuth() {
+		options = append(options, conflate.WithHostAuth(host, auth))
+	}
+	if conflate.Coercion(*coerce) == conflate.CoerceSchema {
+		options = append(options, conflate.WithCoercionSchema(loadSchema()))
+	}
+	for _, p := range arrayMergePaths {
+		pattern, strategy, err := splitPair(p)
+		failIfError(err)
+		options = append(options, conflate.WithPathArrayMerge(pattern, conflate.ArrayMerge(strategy)))
+	}
+	for _, p := range arrayMergeKeys {
+		pattern, key, err := splitPair(p)
+		failIfError(err)
+		options = append(options, conflate.WithArrayMergeKey(pattern, key))
+	}
+	return options
+}
+
+func loadAuth() map[string]conflate.HostAuth {
+	if *authFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(*authFile)
+	failIfError(err)
+	var auths map[string]conflate.HostAuth
+	err = conflate.YAMLUnmarshal(b, &auths)
+	failIfError(err)
+	return auths
+}
+
+func loadTrustedKeys() []ed25519.PublicKey {
+	var keys []ed25519.PublicKey
+	for _, path := range trustedKeys {
+		b, err := ioutil.ReadFile(path)
+		failIfError(err)
+		key, err := parsePublicKey(b)
+		if err != nil {
+			failIfError(fmt.Errorf("Could not parse the trusted key : %v : %v", path, err))
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func parsePublicKey(b []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("The key is not an ed25519 key")
+		}
+		return edKey, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("The key is not an ed25519 key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func loadLock() conflate.Lock {
+	b, err := ioutil.ReadFile(*lockFile)
+	failIfError(err)
+	var lock conflate.Lock
+	err = conflate.YAMLUnmarshal(b, &lock)
+	failIfError(err)
+	if lock == nil {
+		lock = conflate.Lock{}
+	}
+	return lock
+}
+
+func load(data []string) *conflate.Conflate {
+	c := conflate.New(options()...)
 	c.Expand(*expand)
+	ctx, cancel := loadContext()
+	defer cancel()
 
 	if len(data) == 0 {
 		data = append(data, "stdin")
@@ -54,20 +260,49 @@ func main() {
 		if d == "stdin" {
 			b, err := ioutil.ReadAll(os.Stdin)
 			failIfError(err)
-			err = c.AddData(b)
+			err = c.AddDataContext(ctx, b)
 			failIfError(err)
 		} else {
-			err := c.AddFiles(d)
+			err := c.AddFilesContext(ctx, d)
 			failIfError(err)
 		}
 	}
 
-	var schema *conflate.Schema
-	if *schemaFile != "" {
-		s, err := conflate.NewSchemaFile(*schemaFile)
-		failIfError(err)
-		schema = s
+	for _, p := range patches {
+		if p == "stdin" {
+			b, err := ioutil.ReadAll(os.Stdin)
+			failIfError(err)
+			if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+				err = c.ApplyJSONPatch(b)
+			} else {
+				err = c.ApplyMergePatch(b)
+			}
+			failIfError(err)
+		} else {
+			err := c.ApplyPatchFilesContext(ctx, p)
+			failIfError(err)
+		}
+	}
+
+	for _, conflict := range c.Conflicts() {
+		fmt.Fprintln(os.Stderr, "Warning :", conflict)
+	}
+	return c
+}
+
+func loadSchema() *conflate.Schema {
+	if *schemaFile == "" {
+		return nil
 	}
+	ctx, cancel := loadContext()
+	defer cancel()
+	schema, err := conflate.NewSchemaFileContext(ctx, *schemaFile)
+	failIfError(err)
+	return schema
+}
+
+func output(c *conflate.Conflate) {
+	schema := loadSchema()
 	if *defaults {
 		err := c.ApplyDefaults(schema)
 		failIfError(err)
@@ -95,13 +330,118 @@ func main() {
 	}
 }
 
-type dataFlag []string
+func explain(c *conflate.Conflate, path string) {
+	if path == "" {
+		failIfError(fmt.Errorf("The explain command requires a path, e.g. '#/parent/child'"))
+	}
+	sources := c.Provenance(path)
+	if len(sources) == 0 {
+		failIfError(fmt.Errorf("No sources found for path : %v", path))
+	}
+	for _, source := range sources {
+		fmt.Println(source)
+	}
+}
+
+func graph(c *conflate.Conflate) {
+	nodes := c.IncludeGraph()
+	switch strings.ToLower(*format) {
+	case "", "dot":
+		fmt.Println("digraph includes {")
+		writeDot(nodes, "")
+		fmt.Println("}")
+	case "json":
+		out, err := json.MarshalIndent(nodes, "", "  ")
+		failIfError(err)
+		fmt.Println(string(out))
+	default:
+		failIfError(fmt.Errorf("Unknown graph format : %v", *format))
+	}
+}
+
+// writeDot writes the nodes, and an edge from the parent to each node labelled with the order it is merged in
+func writeDot(nodes []*conflate.IncludeNode, parent string) {
+	for i, node := range nodes {
+		name := node.URL
+		if name == "" {
+			name = "<data>"
+		}
+		if parent == "" {
+			fmt.Printf("  %q;\n", name)
+		} else {
+			fmt.Printf("  %q -> %q [label=\"%v\"];\n", parent, name, i+1)
+		}
+		writeDot(node.Includes, name)
+	}
+}
+
+func diff(c *conflate.Conflate, other *conflate.Conflate) {
+	changes := c.Diff(other)
+	switch strings.ToLower(*diffFormat) {
+	case "text":
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	case "json":
+		out, err := json.MarshalIndent(changes, "", "  ")
+		failIfError(err)
+		fmt.Println(string(out))
+	case "patch":
+		out, err := conflate.JSONPatch(changes)
+		failIfError(err)
+		os.Stdout.Write(out)
+	default:
+		failIfError(fmt.Errorf("Unknown diff format : %v", *diffFormat))
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func merge3(paths []string) {
+	if len(paths) != 3 {
+		failIfError(fmt.Errorf("The merge3 command requires the base, ours and theirs files"))
+	}
+	c, conflicts := conflate.Merge3(load(paths[:1]), load(paths[1:2]), load(paths[2:]))
+	output(c)
+	if len(conflicts) > 0 {
+		out, err := json.MarshalIndent(conflicts, "", "  ")
+		failIfError(err)
+		fmt.Fprintln(os.Stderr, string(out))
+		os.Exit(1)
+	}
+}
 
-func (f *dataFlag) String() string {
+func lock(data []string) {
+	path := *lockFile
+	// the urls are loaded without enforcing the existing lock, which is replaced
+	*lockFile = ""
+	out, err := json.MarshalIndent(load(data).Lock(), "", "  ")
+	failIfError(err)
+	out = append(out, '\n')
+	if path == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	err = ioutil.WriteFile(path, out, 0644)
+	failIfError(err)
+}
+
+type listFlag []string
+
+func (f *listFlag) String() string {
 	return strings.Join(*f, ",")
 }
 
-func (f *dataFlag) Set(value string) error {
+func (f *listFlag) Set(value string) error {
 	*f = append(*f, value)
 	return nil
 }
+
+func splitPair(pair string) (string, string, error) {
+	i := strings.LastIndex(pair, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("Expected a key=value pair : %v", pair)
+	}
+	return pair[:i], pair[i+1:], nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary runs the command when started by testRun
+	if os.Getenv("CONFLATE_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testRun(t *testing.T, args ...string) map[string]interface{} {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CONFLATE_TEST_MAIN=1")
+	out, err := cmd.Output()
+	assert.Nil(t, err, "%s", out)
+	var data map[string]interface{}
+	err = json.Unmarshal(out, &data)
+	assert.Nil(t, err, "%s", out)
+	return data
+}
+
+func TestPatch_YAMLMergePatch(t *testing.T) {
+	dir := t.TempDir()
+	patch := filepath.Join(dir, "override.yaml")
+	err := os.WriteFile(patch, []byte("all: patched\nchild_only: null\n"), 0o644)
+	assert.Nil(t, err)
+	data := testRun(t, "-data", "../testdata/valid_parent.json", "-patch", patch, "-format", "JSON")
+	assert.Equal(t, "patched", data["all"])
+	assert.NotContains(t, data, "child_only")
+	assert.Equal(t, "parent", data["parent_only"])
+}
+
+func TestPatch_YAMLJSONPatch(t *testing.T) {
+	dir := t.TempDir()
+	patch := filepath.Join(dir, "override.patch.yaml")
+	err := os.WriteFile(patch, []byte("- {op: replace, path: /all, value: patched}\n"), 0o644)
+	assert.Nil(t, err)
+	data := testRun(t, "-data", "../testdata/valid_parent.json", "-patch", patch, "-format", "JSON")
+	assert.Equal(t, "patched", data["all"])
+}
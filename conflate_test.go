@@ -2,9 +2,14 @@ package conflate
 
 import (
 	gocontext "context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -239,6 +244,167 @@ func TestFromFiles_ApplyDefaults(t *testing.T) {
 	assert.Equal(t, "parent", testData.All)
 }
 
+func TestNew_ArrayMergeOptions(t *testing.T) {
+	c := New(WithArrayMerge(ArrayUnion), WithPathArrayMerge("#/hosts", ArrayReplace))
+	err := c.AddData([]byte(`{"hosts": ["a", "b"], "ports": [1, 2]}`), []byte(`{"hosts": ["c"], "ports": [2, 3]}`))
+	assert.Nil(t, err)
+	var data map[string][]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"c"}, data["hosts"])
+	assert.Equal(t, 3, len(data["ports"]))
+}
+
+func TestAddData_Directives(t *testing.T) {
+	c, err := FromData(
+		[]byte(`{"features": {"beta": {"enabled": true}, "audit": {"level": 1, "sinks": ["file"]}}}`),
+		[]byte(`{"features": {"beta": {"$delete": true}, "audit": {"$replace": {"level": 2}}}}`))
+	assert.Nil(t, err)
+	data, err := c.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, `{
+  "features": {
+    "audit": {
+      "level": 2
+    }
+  }
+}
+`, string(data))
+}
+
+func TestConflate_ApplyMergePatch(t *testing.T) {
+	c, err := FromData([]byte(`{"x": {"y": 1, "z": 2}}`))
+	assert.Nil(t, err)
+	err = c.ApplyMergePatch([]byte(`{"x": {"y": null}}`))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"z": int64(2)}}, data)
+	err = c.ApplyMergePatch([]byte(`{bad`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not unmarshal merge patch")
+}
+
+func TestConflate_ApplyJSONPatch(t *testing.T) {
+	c, err := FromData([]byte(`{"x": [1, 2]}`))
+	assert.Nil(t, err)
+	err = c.ApplyJSONPatch([]byte(`[{"op": "remove", "path": "/x/0"}]`))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": []interface{}{int64(2)}}, data)
+	err = c.ApplyJSONPatch([]byte(`{"op": "remove"}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not unmarshal json patch")
+	err = c.ApplyJSONPatch([]byte(`[{"op": "remove", "path": "/y"}]`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The path '/y' does not exist")
+}
+
+func TestConflate_ApplyPatchFiles(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"override.yaml":       "x:\n  a: null\n",
+		"override.toml":       "[x]\nw = 3\n",
+		"ops.patch.yaml":      "- {op: remove, path: /x/b}\n",
+		"ops.json":            `[{"op": "add", "path": "/v", "value": 4}]`,
+		"bad.merge-patch.yml": "- {op: remove, path: /x}\n",
+	})
+	c, err := FromData([]byte(`{"x": {"a": 1, "b": 2}}`))
+	assert.Nil(t, err)
+	err = c.ApplyPatchFiles(filepath.Join(dir, "override.yaml"), filepath.Join(dir, "override.toml"), filepath.Join(dir, "ops.patch.yaml"), filepath.Join(dir, "ops.json"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"w": int64(3)}, "v": int64(4)}, data)
+	sources := c.Provenance("#/x/w")
+	assert.Equal(t, 1, len(sources))
+	assert.Contains(t, sources[0].URL, "/override.toml")
+	err = c.ApplyPatchFiles(filepath.Join(dir, "bad.merge-patch.yml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not unmarshal patch file://")
+}
+
+func TestConflate_ApplyPatchFilesIncludes(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"p.merge-patch.json": `{"includes": ["child.yaml"], "a": null}`,
+		"child.yaml":         "c: child\n",
+		"obj.patch.yaml":     "b: null\n",
+	})
+	c, err := FromData([]byte(`{"a": 1, "b": 2, "d": 3}`))
+	assert.Nil(t, err)
+	err = c.ApplyPatchFiles(filepath.Join(dir, "p.merge-patch.json"), filepath.Join(dir, "obj.patch.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"c": "child", "d": int64(3)}, c.data)
+}
+
+func TestFromFiles_PatchSuffixObject(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{"app.patch.yaml": "a: 1\n"})
+	c, err := FromFiles(filepath.Join(dir, "app.patch.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, c.data)
+}
+
+func TestFromFiles_PatchIncludes(t *testing.T) {
+	c, err := FromFiles("testdata/patches/data.yaml")
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":     "service",
+		"hosts":    []interface{}{"prod", "prod2"},
+		"database": map[string]interface{}{"host": "db.prod"},
+		"port":     int64(5432),
+	}, data)
+}
+
+func TestConflate_Provenance(t *testing.T) {
+	c, err := FromFiles("testdata/valid_parent.json")
+	assert.Nil(t, err)
+	err = c.ApplyMergePatch([]byte(`{"child_only": "patched"}`))
+	assert.Nil(t, err)
+	sources := c.Provenance("#/parent_child")
+	assert.Equal(t, 2, len(sources))
+	assert.Contains(t, sources[0].URL, "testdata/valid_child.json")
+	assert.Equal(t, Source{URL: sources[0].URL, Line: 4, Column: 19}, sources[0])
+	assert.Contains(t, sources[1].URL, "testdata/valid_parent.json")
+	assert.Equal(t, sources, c.Provenance("/parent_child"))
+	sources = c.Provenance("#/child_only")
+	assert.Equal(t, 2, len(sources))
+	assert.Equal(t, Source{Line: 1, Column: 16}, sources[1])
+	assert.Nil(t, c.Provenance("#/missing"))
+}
+
+func TestConflate_ProvenanceJSONPatch(t *testing.T) {
+	c, err := FromData([]byte(`{"x": {"y": [1]}}`))
+	assert.Nil(t, err)
+	err = c.ApplyJSONPatch([]byte(`[{"op": "add", "path": "/x/y/-", "value": 2}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(c.Provenance("#/x/y[1]")))
+}
+
+func TestConflate_Conflicts(t *testing.T) {
+	c := New(WithStrict(StrictWarn))
+	err := c.AddFiles("testdata/valid_parent.json")
+	assert.Nil(t, err)
+	conflicts := c.Conflicts()
+	assert.Equal(t, 5, len(conflicts))
+	for _, conflict := range conflicts {
+		if conflict.Path == "#/sibling_child" {
+			assert.Contains(t, conflict.Previous.URL, "valid_child.json")
+			assert.Contains(t, conflict.Source.URL, "valid_sibling.json")
+		}
+	}
+
+	c = New(WithStrict(StrictError))
+	err = c.AddFiles("testdata/valid_parent.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "is overridden by")
+}
+
 func TestFromData(t *testing.T) {
 	c, err := FromData([]byte(`{"x": 1}`))
 	assert.Nil(t, err)
@@ -321,6 +487,56 @@ func TestConflate_mergeDataError(t *testing.T) {
 	assert.Contains(t, err.Error(), "Failed to merge")
 }
 
+func TestConflate_RegisterScheme(t *testing.T) {
+	c := New()
+	c.RegisterScheme("env", SchemeHandlerFunc(func(ctx gocontext.Context, u url.URL) ([]byte, error) {
+		return []byte(fmt.Sprintf(`{"%v": "value"}`, u.Host)), nil
+	}))
+	err := c.AddData([]byte(`{"includes": ["env://setting"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"setting": "value"}, c.data)
+}
+
+func TestConflate_AddURLsContextCancelled(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	c := New()
+	err := c.AddFilesContext(ctx, "testdata/valid_parent.json")
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, gocontext.Canceled))
+	_, err = FromDataContext(ctx, []byte(`{"includes": ["testdata/valid_child.json"]}`))
+	assert.True(t, errors.Is(err, gocontext.Canceled))
+	c, err = FromDataContext(gocontext.Background(), []byte(`{"includes": ["testdata/valid_child.json"]}`))
+	assert.Nil(t, err)
+	assert.NotNil(t, c.data)
+}
+
+func TestConflate_WithMergeFunc(t *testing.T) {
+	max := func(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+		if fromData.(int64) > toData.(int64) {
+			return fromData, nil
+		}
+		return toData, nil
+	}
+	c := New(WithMergeFunc("#/timeouts/*", reflect.Int64, max))
+	err := c.AddData([]byte(`{"timeouts": {"read": 10, "write": 5}}`), []byte(`{"timeouts": {"read": 5, "write": 20}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"timeouts": map[string]interface{}{"read": int64(10), "write": int64(20)}}, c.data)
+}
+
+func TestConflate_mergeDataUnchanged(t *testing.T) {
+	fd := filedata{obj: map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{int64(1)}}}}
+	c := New()
+	err := c.mergeData(fd, fd, fd)
+	assert.Nil(t, err)
+	snapshot := c.data
+	err = c.mergeData(fd)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{int64(1)}}}, fd.obj)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{int64(1), int64(1), int64(1)}}}, snapshot)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{int64(1), int64(1), int64(1), int64(1)}}}, c.data)
+}
+
 func TestConflate_IncludesWithMapArray(t *testing.T) {
 	c, err := FromFiles("testdata/merge_includes_with_map_array/data.json")
 	assert.NoError(t, err)
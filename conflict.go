@@ -0,0 +1,62 @@
+package conflate
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// StrictMode defines how a value that is overridden by a different source is reported
+type StrictMode string
+
+const (
+	// StrictOff does not report overridden values
+	StrictOff StrictMode = "off"
+	// StrictWarn collects the overridden values as conflicts, see Conflicts
+	StrictWarn StrictMode = "warn"
+	// StrictError fails the merge at the first overridden value
+	StrictError StrictMode = "error"
+)
+
+// Conflict describes a value that was set by one source and overridden by another
+type Conflict struct {
+	Path     string
+	Previous Source
+	Source   Source
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("The value set by %v is overridden by %v (%v)", c.Previous, c.Source, c.Path)
+}
+
+// checkConflict reports a scalar value, or the type of a value, being changed by a different source than the one that last set it.
+// Sources are compared by merge, so data without a url, and the same file merged twice, are different sources. Numbers are
+// compared by value, so the same number decoded from different formats is not a change.
+func (m *merger) checkConflict(ctx context, toData interface{}, fromData interface{}) error {
+	if m.strict == "" || m.strict == StrictOff || equalValues(toData, fromData) {
+		return nil
+	}
+	toKind := reflect.ValueOf(toData).Kind()
+	fromKind := reflect.ValueOf(fromData).Kind()
+	if toKind == fromKind && (toKind == reflect.Map || toKind == reflect.Slice) {
+		return nil
+	}
+	var previous Source
+	if sources := m.provenance[ctx]; len(sources) > 0 {
+		previous = sources[len(sources)-1]
+	}
+	if m.owners[ctx] == m.source {
+		return nil
+	}
+	conflict := Conflict{Path: ctx.String(), Previous: previous, Source: m.source.at(ctx)}
+	if m.strict == StrictError {
+		// the path is added by the caller merging the parent object or array
+		return makeError("The value set by %v is overridden by %v", conflict.Previous, conflict.Source)
+	}
+	if m.strict != StrictWarn {
+		return makeContextError(ctx, "Unknown strict mode (%v)", m.strict)
+	}
+	if m.conflicts != nil {
+		*m.conflicts = append(*m.conflicts, conflict)
+	}
+	return nil
+}
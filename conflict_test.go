@@ -0,0 +1,113 @@
+package conflate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConflictMerge(m *merger, sources ...interface{}) error {
+	var toData interface{}
+	for i, source := range sources {
+		m.source = &sourceMap{url: string(rune('a' + i))}
+		err := m.merge(&toData, source)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCheckConflict_Off(t *testing.T) {
+	var conflicts []Conflict
+	m := &merger{provenance: make(provenance), strict: StrictOff, conflicts: &conflicts}
+	err := testConflictMerge(m, map[string]interface{}{"x": 1}, map[string]interface{}{"x": 2})
+	assert.Nil(t, err)
+	assert.Nil(t, conflicts)
+}
+
+func TestCheckConflict_Warn(t *testing.T) {
+	var conflicts []Conflict
+	m := &merger{provenance: make(provenance), strict: StrictWarn, conflicts: &conflicts}
+	err := testConflictMerge(m,
+		map[string]interface{}{"x": 1, "y": 1, "z": map[string]interface{}{"a": 1}, "arr": []interface{}{1}},
+		map[string]interface{}{"x": 2, "y": 1, "z": map[string]interface{}{"a": 1, "b": 1}, "arr": []interface{}{2}},
+		map[string]interface{}{"x": 3, "z": map[string]interface{}{"b": map[string]interface{}{"$replace": 2}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []Conflict{
+		{Path: "#/x", Previous: Source{URL: "a"}, Source: Source{URL: "b"}},
+		{Path: "#/x", Previous: Source{URL: "b"}, Source: Source{URL: "c"}},
+	}, conflicts)
+}
+
+func TestCheckConflict_SameSource(t *testing.T) {
+	var conflicts []Conflict
+	m := &merger{provenance: make(provenance), strict: StrictError, conflicts: &conflicts}
+	var toData interface{}
+	m.source = &sourceMap{url: "a"}
+	err := m.merge(&toData, map[string]interface{}{"x": 1})
+	assert.Nil(t, err)
+	err = m.merge(&toData, map[string]interface{}{"x": 2})
+	assert.Nil(t, err)
+}
+
+func TestCheckConflict_Error(t *testing.T) {
+	m := &merger{provenance: make(provenance), strict: StrictError}
+	err := testConflictMerge(m, map[string]interface{}{"x": map[string]interface{}{"y": 1}}, map[string]interface{}{"x": "str"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The value set by a is overridden by b (#/x)")
+}
+
+func TestCheckConflict_UnknownMode(t *testing.T) {
+	m := &merger{provenance: make(provenance), strict: "bad"}
+	err := testConflictMerge(m, map[string]interface{}{"x": 1}, map[string]interface{}{"x": 2})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown strict mode (bad)")
+}
+
+func TestConflict_String(t *testing.T) {
+	c := Conflict{Path: "#/x", Previous: Source{URL: "a", Line: 1, Column: 2}, Source: Source{}}
+	assert.Equal(t, "The value set by a:1:2 is overridden by <data> (#/x)", c.String())
+}
+
+func TestCheckConflict_Data(t *testing.T) {
+	c := New(WithStrict(StrictWarn))
+	err := c.AddData([]byte(`{"x": 1}`), []byte(`{"x": 2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Conflict{{Path: "#/x", Previous: Source{Line: 1, Column: 7}, Source: Source{Line: 1, Column: 7}}}, c.Conflicts())
+
+	c = New(WithStrict(StrictError))
+	err = c.AddData([]byte(`{"x": 1}`), []byte(`{"x": 2}`))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, strings.Count(err.Error(), "(#/x)"), err.Error())
+}
+
+func TestCheckConflict_KeyedArray(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"a.json": `{"services": [{"name": "a", "port": 1}]}`,
+		"b.json": `{"services": [{"name": "a", "port": 2}]}`,
+	})
+	c := New(WithStrict(StrictWarn), WithArrayMergeKey("#/services", "name"))
+	err := c.AddFiles(filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"))
+	assert.Nil(t, err)
+	conflicts := c.Conflicts()
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "#/services[0]/port", conflicts[0].Path)
+	assert.Contains(t, conflicts[0].Previous.URL, "/a.json")
+	assert.Contains(t, conflicts[0].Source.URL, "/b.json")
+}
+
+func TestCheckConflict_MixedFormats(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"a.yaml": "port: 8080\nhost: a\n",
+		"b.json": `{"port": 8080, "host": "b"}`,
+	})
+	c := New(WithStrict(StrictWarn), WithCoercion(CoerceNumeric))
+	err := c.AddFiles(filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.json"))
+	assert.Nil(t, err)
+	conflicts := c.Conflicts()
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "#/host", conflicts[0].Path)
+}
@@ -3,8 +3,12 @@ package conflate
 import (
 	"fmt"
 	"path"
+	"regexp"
+	"strings"
 )
 
+var arrayIndex = regexp.MustCompile(`\[[0-9]+\]`)
+
 func rootContext() context {
 	return context("#")
 }
@@ -20,3 +24,19 @@ func (c context) add(s ...string) context {
 func (c context) addInt(i int) context {
 	return context(fmt.Sprintf("%v[%v]", c.String(), i))
 }
+
+func (c context) match(pattern string) bool {
+	ok, err := path.Match(pattern, arrayIndex.ReplaceAllString(c.String(), ""))
+	return ok && err == nil
+}
+
+func (c context) parent() context {
+	s := c.String()
+	if locs := arrayIndex.FindAllStringIndex(s, -1); locs != nil && locs[len(locs)-1][1] == len(s) {
+		return context(s[:locs[len(locs)-1][0]])
+	}
+	if i := strings.LastIndex(s, "/"); i > 0 {
+		return context(s[:i])
+	}
+	return rootContext()
+}
@@ -23,3 +23,18 @@ func TestMakeContext_AddInt(t *testing.T) {
 	assert.Equal(t, "#", ctx.String())
 	assert.Equal(t, "#/parent[3]", ctx2.String())
 }
+
+func TestContext_Match(t *testing.T) {
+	ctx := rootContext().add("services").addInt(2).add("ports")
+	assert.True(t, ctx.match("#/services/ports"))
+	assert.True(t, ctx.match("#/*/ports"))
+	assert.False(t, ctx.match("#/services"))
+	assert.False(t, ctx.match("#/[bad"))
+}
+
+func TestContext_Parent(t *testing.T) {
+	assert.Equal(t, context("#/a[1]"), context("#/a[1]/b").parent())
+	assert.Equal(t, context("#/a[1]/b"), context("#/a[1]/b[2]").parent())
+	assert.Equal(t, context("#"), context("#/a").parent())
+	assert.Equal(t, context("#"), context("#").parent())
+}
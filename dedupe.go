@@ -0,0 +1,181 @@
+package conflate
+
+import (
+	gocontext "context"
+	"fmt"
+	pkgurl "net/url"
+	"sync"
+)
+
+// Dedupe defines which of the files loaded from the same url is merged, when a url is included more than once
+type Dedupe string
+
+const (
+	// DedupeOff merges each file, however many times its url is included
+	DedupeOff Dedupe = "off"
+	// DedupeFirst merges only the first file, in merge order, loaded from each url
+	DedupeFirst Dedupe = "first"
+	// DedupeLast merges only the last file, in merge order, loaded from each url
+	DedupeLast Dedupe = "last"
+)
+
+// loadState is the state of loading the urls passed to a single call, such as AddFiles, which is shared through the context
+type loadState struct {
+	mutex   sync.Mutex
+	files   int
+	fetches map[pkgurl.URL]*fetch
+	walks   map[string]*walk
+}
+
+// fetch is the result of loading a url, which is shared by the includes of the same url when deduplicating
+type fetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// walk is the data of an include, and of its own includes, which is loaded once for the includes of the same url at the same
+// mount point when deduplicating. Each of the includes is replaced by a filedata referring to the walk, which is expanded once
+// all the urls are loaded, as the walk may not be complete until then.
+type walk struct {
+	url pkgurl.URL
+	// data is mounted at the root, rather than under the include
+	data      filedatas
+	expanding bool
+	expanded  filedatas
+}
+
+type loadStateKey struct{}
+
+func (l *loader) withLoadState(ctx gocontext.Context) gocontext.Context {
+	return gocontext.WithValue(ctx, loadStateKey{}, &loadState{fetches: make(map[pkgurl.URL]*fetch), walks: make(map[string]*walk)})
+}
+
+// claimWalk returns the walk of the include when deduplicating, and whether it is the first include of the walk, which loads it.
+// Includes that verify the data differently are walked separately, so that an include is never merged without its checks.
+func (l *loader) claimWalk(ctx gocontext.Context, include includeURL) (*walk, bool) {
+	state, ok := ctx.Value(loadStateKey{}).(*loadState)
+	if !ok || l.dedupe == "" || l.dedupe == DedupeOff {
+		return nil, true
+	}
+	key := fmt.Sprintf("%v#%v %v %v", include.url.String(), formatPointer(include.node.mount), include.optional, include.sha256)
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if w, ok := state.walks[key]; ok {
+		return w, false
+	}
+	w := &walk{url: include.url}
+	state.walks[key] = w
+	return w, true
+}
+
+// expandWalks replaces the filedatas referring to walks with the data of the walks
+func expandWalks(data filedatas) (filedatas, error) {
+	var expanded filedatas
+	for _, fd := range data {
+		w := fd.walk
+		if w == nil {
+			expanded = append(expanded, fd)
+			continue
+		}
+		if w.expanding {
+			return nil, makeError("The url recursively includes itself (%v)", w.url.Redacted())
+		}
+		if w.expanded == nil {
+			w.expanding = true
+			walkData, err := expandWalks(w.data)
+			w.expanding = false
+			if err != nil {
+				return nil, err
+			}
+			w.expanded = append(filedatas{}, walkData...)
+		}
+		expanded = append(expanded, w.expanded...)
+	}
+	return expanded, nil
+}
+
+// countFile fails when the number of files loaded by the call exceeds the maximum, where the includes of a walk count once
+func (l *loader) countFile(ctx gocontext.Context) error {
+	state, ok := ctx.Value(loadStateKey{}).(*loadState)
+	if !ok || l.maxFiles <= 0 {
+		return nil
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.files++
+	if state.files > l.maxFiles {
+		return makeError("The number of files loaded exceeds the maximum of %v", l.maxFiles)
+	}
+	return nil
+}
+
+// fetchURL loads each url once for the call when deduplicating, so that concurrent includes of the url share its data
+func (l *loader) fetchURL(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	state, ok := ctx.Value(loadStateKey{}).(*loadState)
+	if !ok || l.dedupe == "" || l.dedupe == DedupeOff {
+		return l.loadURL(ctx, url)
+	}
+	state.mutex.Lock()
+	f, ok := state.fetches[url]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		state.fetches[url] = f
+	}
+	state.mutex.Unlock()
+	if ok {
+		select {
+		case <-f.done:
+			return f.data, f.err
+		case <-ctx.Done():
+			return nil, wrapError(ctx.Err(), "Failed to load url %v", url.Redacted())
+		}
+	}
+	f.data, f.err = l.loadURL(ctx, url)
+	close(f.done)
+	return f.data, f.err
+}
+
+// dedupeData removes the files loaded from the same url, and merged at the same mount point, other than the first or the last
+func (l *loader) dedupeData(data filedatas) (filedatas, error) {
+	switch l.dedupe {
+	case "", DedupeOff:
+		return data, nil
+	}
+	data, err := expandWalks(data)
+	if err != nil {
+		return nil, err
+	}
+	switch l.dedupe {
+	case DedupeFirst:
+		return dedupeFirst(data), nil
+	case DedupeLast:
+		reversed := dedupeFirst(data.reversed())
+		return reversed.reversed(), nil
+	}
+	return nil, makeError("Unknown dedupe mode (%v)", l.dedupe)
+}
+
+func dedupeFirst(data filedatas) filedatas {
+	seen := make(map[string]bool)
+	var deduped filedatas
+	for _, fd := range data {
+		if fd.url != emptyURL {
+			key := fd.url.String() + "#" + formatPointer(fd.at)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		deduped = append(deduped, fd)
+	}
+	return deduped
+}
+
+func (fds filedatas) reversed() filedatas {
+	reversed := make(filedatas, len(fds))
+	for i, fd := range fds {
+		reversed[len(fds)-1-i] = fd
+	}
+	return reversed
+}
@@ -0,0 +1,149 @@
+package conflate
+
+import (
+	gocontext "context"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDiamondDir(t *testing.T) string {
+	return testGlobDir(t, map[string]string{
+		"main.yaml":   "includes: [a.yaml, b.yaml]\nlist: [main]\n",
+		"a.yaml":      "includes: [common.yaml]\nlist: [a]\nvalue: a\n",
+		"b.yaml":      "includes: [common.yaml]\nlist: [b]\n",
+		"common.yaml": "list: [common]\nvalue: common\n",
+	})
+}
+
+func testDedupe(t *testing.T, dedupe Dedupe) map[string]interface{} {
+	c := New(WithDedupe(dedupe))
+	err := c.AddFiles(filepath.Join(testDiamondDir(t), "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestWithDedupe(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{"list": []interface{}{"common", "a", "common", "b", "main"}, "value": "common"}, testDedupe(t, DedupeOff))
+	assert.Equal(t, map[string]interface{}{"list": []interface{}{"common", "a", "b", "main"}, "value": "a"}, testDedupe(t, DedupeFirst))
+	assert.Equal(t, map[string]interface{}{"list": []interface{}{"a", "common", "b", "main"}, "value": "common"}, testDedupe(t, DedupeLast))
+}
+
+func TestWithDedupe_Unknown(t *testing.T) {
+	c := New(WithDedupe("other"))
+	err := c.AddFiles(filepath.Join(testDiamondDir(t), "main.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown dedupe mode (other)")
+}
+
+func TestWithDedupe_Mounts(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml": "includes: [{path: db.yaml, at: /primary}, {path: db.yaml, at: /replica}, {path: db.yaml, at: /replica}]\n",
+		"db.yaml":   "hosts: [db]\n",
+	})
+	c := New(WithDedupe(DedupeFirst))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"primary": map[string]interface{}{"hosts": []interface{}{"db"}},
+		"replica": map[string]interface{}{"hosts": []interface{}{"db"}},
+	}, data)
+}
+
+func TestWithDedupe_LoadsOnce(t *testing.T) {
+	var loads int32
+	handler := testMemoryHandler(map[string]string{
+		"c/root.json":   `{"includes": ["a.json", "b.json", "common.json"]}`,
+		"c/a.json":      `{"includes": ["common.json"]}`,
+		"c/b.json":      `{"includes": ["common.json"]}`,
+		"c/common.json": `{"x": 1}`,
+	})
+	c := New(WithDedupe(DedupeFirst))
+	c.RegisterScheme("mem", SchemeHandlerFunc(func(ctx gocontext.Context, u url.URL) ([]byte, error) {
+		if u.Path == "/common.json" {
+			atomic.AddInt32(&loads, 1)
+		}
+		return handler.Load(ctx, u)
+	}))
+	err := c.AddURLs(url.URL{Scheme: "mem", Host: "c", Path: "/root.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestWithMaxIncludeDepth(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"a.yaml": "includes: [b.yaml]\n",
+		"b.yaml": "includes: [c.yaml]\n",
+		"c.yaml": "x: 1\n",
+	})
+	c := New(WithMaxIncludeDepth(2))
+	err := c.AddFiles(filepath.Join(dir, "a.yaml"))
+	assert.Nil(t, err)
+
+	c = New(WithMaxIncludeDepth(1))
+	err = c.AddFiles(filepath.Join(dir, "a.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The include depth exceeds the maximum of 1 : file://")
+	assert.Contains(t, err.Error(), "c.yaml")
+}
+
+func TestWithMaxFiles(t *testing.T) {
+	dir := testDiamondDir(t)
+	c := New(WithMaxFiles(5))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+
+	c = New(WithMaxFiles(4))
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The number of files loaded exceeds the maximum of 4")
+}
+
+func TestWithMaxFiles_Dedupe(t *testing.T) {
+	for _, dedupe := range []Dedupe{DedupeFirst, DedupeLast} {
+		c := New(WithDedupe(dedupe), WithMaxFiles(4), WithConcurrency(4))
+		err := c.AddFiles(filepath.Join(testDiamondDir(t), "main.yaml"))
+		assert.Nil(t, err, "%v", dedupe)
+	}
+}
+
+func TestWithDedupe_Recursive(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml": "includes: [a.yaml, b.yaml]\n",
+		"a.yaml":    "includes: [b.yaml]\n",
+		"b.yaml":    "includes: [a.yaml]\n",
+	})
+	for _, concurrency := range []int{1, 4} {
+		c := New(WithDedupe(DedupeFirst), WithConcurrency(concurrency))
+		err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "The url recursively includes itself")
+	}
+}
+
+func TestWithDedupe_NestedMounts(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml":   "includes: [{path: a.yaml, at: /x}, b.yaml]\n",
+		"a.yaml":      "includes: [common.yaml]\n",
+		"b.yaml":      "includes: [{path: common.yaml, at: /x}]\n",
+		"common.yaml": "list: [common]\n",
+	})
+	c := New(WithDedupe(DedupeLast), WithMaxFiles(4))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"list": []interface{}{"common"}}}, data)
+}
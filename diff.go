@@ -0,0 +1,121 @@
+package conflate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ChangeType defines how a value differs between two configurations
+type ChangeType string
+
+const (
+	// ChangeAdd is a value missing from the other configuration
+	ChangeAdd ChangeType = "add"
+	// ChangeRemove is a value only in the other configuration
+	ChangeRemove ChangeType = "remove"
+	// ChangeReplace is a value that differs from the value in the other configuration
+	ChangeReplace ChangeType = "replace"
+)
+
+// Change describes a value that differs between two configurations. From is the value in the other configuration,
+// and To is the value in this configuration, each nil when missing.
+type Change struct {
+	Type    ChangeType  `json:"type"`
+	Path    string      `json:"path"`
+	From    interface{} `json:"from"`
+	To      interface{} `json:"to"`
+	pointer []string
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeAdd:
+		return fmt.Sprintf("+ %v : %v", c.Path, formatValue(c.To))
+	case ChangeRemove:
+		return fmt.Sprintf("- %v : %v", c.Path, formatValue(c.From))
+	}
+	return fmt.Sprintf("~ %v : %v -> %v", c.Path, formatValue(c.From), formatValue(c.To))
+}
+
+func formatValue(data interface{}) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprint(data)
+	}
+	return string(b)
+}
+
+// Diff reports the values added, removed and replaced in the merged data compared against the merged data of the other instance.
+// Objects are compared property by property, and arrays item by item.
+func (c *Conflate) Diff(other *Conflate) []Change {
+	var changes []Change
+	diff(rootContext(), nil, other.data, c.data, &changes)
+	return changes
+}
+
+// JSONPatch converts the changes reported by Diff to a JSON patch (RFC 6902) that changes the other data into this data
+func JSONPatch(changes []Change) ([]byte, error) {
+	ops := make([]map[string]interface{}, 0, len(changes))
+	for _, change := range changes {
+		op := map[string]interface{}{"op": string(change.Type), "path": formatPointer(change.pointer)}
+		if change.Type != ChangeRemove {
+			op["value"] = change.To
+		}
+		ops = append(ops, op)
+	}
+	return jsonMarshal(ops)
+}
+
+func diff(ctx context, pointer []string, from interface{}, to interface{}, changes *[]Change) {
+	if equalValues(from, to) {
+		return
+	}
+	fromProps, ok1 := from.(map[string]interface{})
+	toProps, ok2 := to.(map[string]interface{})
+	if ok1 && ok2 {
+		diffMap(ctx, pointer, fromProps, toProps, changes)
+		return
+	}
+	fromItems, ok1 := from.([]interface{})
+	toItems, ok2 := to.([]interface{})
+	if ok1 && ok2 {
+		diffSlice(ctx, pointer, fromItems, toItems, changes)
+		return
+	}
+	*changes = append(*changes, Change{Type: ChangeReplace, Path: ctx.String(), From: from, To: to, pointer: pointer})
+}
+
+func diffMap(ctx context, pointer []string, fromProps map[string]interface{}, toProps map[string]interface{}, changes *[]Change) {
+	for _, name := range sortedNames(fromProps, toProps) {
+		fromProp, inFrom := fromProps[name]
+		toProp, inTo := toProps[name]
+		change := Change{Path: ctx.add(name).String(), From: fromProp, To: toProp, pointer: appendToken(pointer, name)}
+		switch {
+		case !inFrom:
+			change.Type = ChangeAdd
+		case !inTo:
+			change.Type = ChangeRemove
+		default:
+			diff(ctx.add(name), change.pointer, fromProp, toProp, changes)
+			continue
+		}
+		*changes = append(*changes, change)
+	}
+}
+
+func diffSlice(ctx context, pointer []string, fromItems []interface{}, toItems []interface{}, changes *[]Change) {
+	for i := 0; i < len(fromItems) && i < len(toItems); i++ {
+		diff(ctx.addInt(i), appendToken(pointer, fmt.Sprint(i)), fromItems[i], toItems[i], changes)
+	}
+	for i := len(fromItems); i < len(toItems); i++ {
+		*changes = append(*changes, Change{Type: ChangeAdd, Path: ctx.addInt(i).String(), To: toItems[i], pointer: appendToken(pointer, fmt.Sprint(i))})
+	}
+	// removed items are reported from the last, so that the indices in the json patch remain valid
+	for i := len(fromItems) - 1; i >= len(toItems); i-- {
+		*changes = append(*changes, Change{Type: ChangeRemove, Path: ctx.addInt(i).String(), From: fromItems[i], pointer: appendToken(pointer, fmt.Sprint(i))})
+	}
+}
+
+func appendToken(pointer []string, token string) []string {
+	return append(append([]string{}, pointer...), token)
+}
@@ -0,0 +1,69 @@
+package conflate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDiff(t *testing.T, data string, against string) (*Conflate, *Conflate, []Change) {
+	c, err := FromData([]byte(data))
+	assert.Nil(t, err)
+	other, err := FromData([]byte(against))
+	assert.Nil(t, err)
+	return c, other, c.Diff(other)
+}
+
+func TestDiff(t *testing.T) {
+	_, _, changes := testDiff(t,
+		`{"a": 1, "b": {"x": 2, "y": 1}, "c": [1, 2, 3], "d": [1], "new": "n"}`,
+		`{"a": 1, "b": {"x": 1, "z": 1}, "c": [1], "d": [2, 3, 4], "old": "o"}`)
+	assert.Equal(t, []Change{
+		{Type: ChangeReplace, Path: "#/b/x", From: int64(1), To: int64(2), pointer: []string{"b", "x"}},
+		{Type: ChangeAdd, Path: "#/b/y", To: int64(1), pointer: []string{"b", "y"}},
+		{Type: ChangeRemove, Path: "#/b/z", From: int64(1), pointer: []string{"b", "z"}},
+		{Type: ChangeAdd, Path: "#/c[1]", To: int64(2), pointer: []string{"c", "1"}},
+		{Type: ChangeAdd, Path: "#/c[2]", To: int64(3), pointer: []string{"c", "2"}},
+		{Type: ChangeReplace, Path: "#/d[0]", From: int64(2), To: int64(1), pointer: []string{"d", "0"}},
+		{Type: ChangeRemove, Path: "#/d[2]", From: int64(4), pointer: []string{"d", "2"}},
+		{Type: ChangeRemove, Path: "#/d[1]", From: int64(3), pointer: []string{"d", "1"}},
+		{Type: ChangeAdd, Path: "#/new", To: "n", pointer: []string{"new"}},
+		{Type: ChangeRemove, Path: "#/old", From: "o", pointer: []string{"old"}},
+	}, changes)
+}
+
+func TestDiff_Equal(t *testing.T) {
+	_, _, changes := testDiff(t, `{"a": {"b": [1]}}`, `{"a": {"b": [1]}}`)
+	assert.Empty(t, changes)
+}
+
+func TestDiff_MixedFormats(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"a.json": `{"port": 8080, "l": [1, 2.5], "o": {"k": 1}}`,
+		"b.yaml": "port: 8080\nl: [1, 2.5]\no: {k: 1}\n",
+	})
+	c, err := FromFiles(filepath.Join(dir, "a.json"))
+	assert.Nil(t, err)
+	other, err := FromFiles(filepath.Join(dir, "b.yaml"))
+	assert.Nil(t, err)
+	assert.Empty(t, c.Diff(other))
+}
+
+func TestChange_String(t *testing.T) {
+	assert.Equal(t, `+ #/a : {"b":"c"}`, Change{Type: ChangeAdd, Path: "#/a", To: map[string]interface{}{"b": "c"}}.String())
+	assert.Equal(t, `- #/a : 1`, Change{Type: ChangeRemove, Path: "#/a", From: 1}.String())
+	assert.Equal(t, `~ #/a : 1 -> "x"`, Change{Type: ChangeReplace, Path: "#/a", From: 1, To: "x"}.String())
+}
+
+func TestJSONPatch_FromDiff(t *testing.T) {
+	c, other, changes := testDiff(t,
+		`{"a": {"x/y": 2}, "c": [1, 2, 3], "d": [1], "new": "n"}`,
+		`{"a": {"x/y": 1, "~z": 1}, "c": [1], "d": [2, 3, 4], "old": "o"}`)
+	patch, err := JSONPatch(changes)
+	assert.Nil(t, err)
+	assert.Contains(t, string(patch), `"path": "/a/~0z"`)
+	err = other.ApplyJSONPatch(patch)
+	assert.Nil(t, err)
+	assert.Equal(t, c.data, other.data)
+}
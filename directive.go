@@ -0,0 +1,167 @@
+package conflate
+
+import (
+	"reflect"
+)
+
+type directive struct {
+	delete   bool
+	replace  bool
+	strategy ArrayMerge
+	value    interface{}
+}
+
+func isDirectiveKey(name string) bool {
+	for _, key := range []string{DeleteDirective, ReplaceDirective, StrategyDirective, MergeDirective} {
+		if key != "" && key == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDirective(ctx context, data interface{}) (*directive, error) {
+	props, ok := data.(map[string]interface{})
+	if !ok || !hasDirectiveKey(props) {
+		return nil, nil
+	}
+	d := &directive{}
+	if val, ok := props[DeleteDirective]; ok && DeleteDirective != "" {
+		if d.delete, ok = val.(bool); !ok {
+			return nil, makeContextError(ctx, "The %v directive must be a boolean", DeleteDirective)
+		}
+	}
+	if val, ok := props[ReplaceDirective]; ok && ReplaceDirective != "" {
+		d.replace = true
+		d.value = val
+		return d, nil
+	}
+	if val, ok := props[StrategyDirective]; ok && StrategyDirective != "" {
+		strategy, _ := val.(string)
+		d.strategy = ArrayMerge(strategy)
+		if !isArrayMerge(d.strategy) {
+			return nil, makeContextError(ctx, "The %v directive must be one of append/prepend/replace/union", StrategyDirective)
+		}
+	}
+	if val, ok := props[MergeDirective]; ok && MergeDirective != "" {
+		d.value = val
+		return d, nil
+	}
+	value := make(map[string]interface{})
+	for name, prop := range props {
+		if !isDirectiveKey(name) {
+			value[name] = prop
+		}
+	}
+	d.value = value
+	return d, nil
+}
+
+func hasDirectiveKey(props map[string]interface{}) bool {
+	for name := range props {
+		if isDirectiveKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDelete(data interface{}) bool {
+	d, err := parseDirective(rootContext(), data)
+	return err == nil && d != nil && d.delete
+}
+
+func isArrayMerge(strategy ArrayMerge) bool {
+	switch strategy {
+	case ArrayAppend, ArrayPrepend, ArrayReplace, ArrayUnion:
+		return true
+	}
+	return false
+}
+
+func (m *merger) mergeDirective(ctx context, pToData interface{}, toVal reflect.Value, d *directive) error {
+	switch {
+	case d.delete:
+		m.provenance.add(ctx, m.source.at(ctx))
+		toVal.Set(reflect.Zero(toVal.Type()))
+		return nil
+	case d.replace || d.strategy == ArrayReplace:
+		return m.replace(ctx, toVal, d.value)
+	case d.strategy != "":
+		sm := *m
+		sm.arrayMerge = d.strategy
+		sm.pathArrayMerges = nil
+		sm.pathArrayMergeKeys = nil
+		return sm.mergeRecursive(ctx, pToData, d.value)
+	}
+	return m.mergeRecursive(ctx, pToData, d.value)
+}
+
+func (m *merger) replace(ctx context, toVal reflect.Value, fromData interface{}) error {
+	fromData, _, err := resolve(ctx, fromData)
+	if err != nil {
+		return err
+	}
+	m.record(ctx, fromData)
+	if fromData == nil {
+		toVal.Set(reflect.Zero(toVal.Type()))
+		return nil
+	}
+	fromVal := reflect.ValueOf(fromData)
+	if !fromVal.Type().AssignableTo(toVal.Type()) {
+		return makeContextError(ctx, "The destination type (%v) must be the same as the source type (%v)", toVal.Type(), fromVal.Type())
+	}
+	toVal.Set(fromVal)
+	return nil
+}
+
+// resolve returns a copy of the data with any directives applied and removed, and false if the data is deleted
+func resolve(ctx context, data interface{}) (interface{}, bool, error) {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		d, err := parseDirective(ctx, data)
+		if err != nil {
+			return nil, false, err
+		}
+		if d != nil {
+			if d.delete {
+				return nil, false, nil
+			}
+			return resolve(ctx, d.value)
+		}
+		return resolveMap(ctx, data)
+	case []interface{}:
+		return resolveSlice(ctx, data)
+	case []map[string]interface{}:
+		return resolveSlice(ctx, toSliceOfInterface(data))
+	}
+	return data, true, nil
+}
+
+func resolveMap(ctx context, data map[string]interface{}) (interface{}, bool, error) {
+	out := make(map[string]interface{}, len(data))
+	for name, prop := range data {
+		val, ok, err := resolve(ctx.add(name), prop)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			out[name] = val
+		}
+	}
+	return out, true, nil
+}
+
+func resolveSlice(ctx context, data []interface{}) (interface{}, bool, error) {
+	out := make([]interface{}, 0, len(data))
+	for i, item := range data {
+		val, ok, err := resolve(ctx.addInt(i), item)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			out = append(out, val)
+		}
+	}
+	return out, true, nil
+}
@@ -0,0 +1,143 @@
+package conflate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMerge_DeleteDirective(t *testing.T) {
+	toData := map[string]interface{}{"x": 1, "y": map[string]interface{}{"z": 1}}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$delete": true}, "y": map[string]interface{}{"z": map[string]interface{}{"$delete": true}}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"y": map[string]interface{}{}}, toData)
+}
+
+func TestMerge_DeleteDirectiveMissing(t *testing.T) {
+	var toData interface{}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$delete": true}, "y": 1}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"y": 1}, toData)
+}
+
+func TestMerge_DeleteDirectiveNotBool(t *testing.T) {
+	toData := map[string]interface{}{"x": 1}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$delete": "yes"}}
+	err := merge(&toData, fromData)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The $delete directive must be a boolean (#/x)")
+}
+
+func TestMerge_ReplaceDirective(t *testing.T) {
+	toData := map[string]interface{}{"x": map[string]interface{}{"a": 1, "b": 2}}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$replace": map[string]interface{}{"c": map[string]interface{}{"$replace": 3}}}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"c": 3}}, toData)
+}
+
+func TestMerge_ReplaceDirectiveType(t *testing.T) {
+	toData := map[string]interface{}{"x": map[string]interface{}{"a": 1}}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$replace": "str"}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": "str"}, toData)
+}
+
+func TestMerge_StrategyDirective(t *testing.T) {
+	toData := map[string]interface{}{"x": []interface{}{1, 2}, "y": map[string]interface{}{"a": []interface{}{1}, "b": 1}}
+	fromData := map[string]interface{}{
+		"x": map[string]interface{}{"$strategy": "prepend", "$merge": []interface{}{3}},
+		"y": map[string]interface{}{"$strategy": "union", "a": []interface{}{1, 2}},
+	}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{3, 1, 2}, toData["x"])
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{1, 2}, "b": 1}, toData["y"])
+}
+
+func TestMerge_StrategyDirectiveReplace(t *testing.T) {
+	toData := map[string]interface{}{"x": map[string]interface{}{"a": 1}}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$strategy": "replace", "b": 2}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"b": 2}}, toData)
+}
+
+func TestMerge_StrategyDirectiveInvalid(t *testing.T) {
+	toData := map[string]interface{}{"x": []interface{}{1}}
+	fromData := map[string]interface{}{"x": map[string]interface{}{"$strategy": "bad", "$merge": []interface{}{2}}}
+	err := merge(&toData, fromData)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The $strategy directive must be one of append/prepend/replace/union")
+}
+
+func TestMerge_DirectiveDisabled(t *testing.T) {
+	old := DeleteDirective
+	DeleteDirective = ""
+	defer func() { DeleteDirective = old }()
+	toData := map[string]interface{}{"x": 1}
+	fromData := map[string]interface{}{"y": map[string]interface{}{"$delete": true}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": 1, "y": map[string]interface{}{"$delete": true}}, toData)
+}
+
+func TestMerge_DirectivesInSlice(t *testing.T) {
+	toData := []interface{}{1}
+	fromData := []interface{}{map[string]interface{}{"$replace": 2}, map[string]interface{}{"$delete": true}}
+	err := merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1, 2}, toData)
+}
+
+func TestMerge_DirectivesInKeyedSlice(t *testing.T) {
+	m := merger{pathArrayMergeKeys: []pathArrayMergeKey{{pattern: "#", key: "name"}}}
+	toData := []interface{}{
+		map[string]interface{}{"name": "api", "port": 80},
+		map[string]interface{}{"name": "worker", "port": 81},
+	}
+	fromData := []interface{}{
+		map[string]interface{}{"name": "api", "$delete": true},
+		map[string]interface{}{"name": "worker", "$strategy": "replace", "debug": true},
+		map[string]interface{}{"name": "cron", "$delete": true},
+	}
+	err := m.merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "worker", "debug": true}}, toData)
+}
+
+func TestMerge_ReplaceInKeyedSlice(t *testing.T) {
+	m := merger{pathArrayMergeKeys: []pathArrayMergeKey{{pattern: "#", key: "name"}}}
+	toData := []interface{}{
+		map[string]interface{}{"name": "a", "v": 1},
+		map[string]interface{}{"name": "b", "v": 1, "debug": true},
+	}
+	fromData := []interface{}{
+		map[string]interface{}{"$replace": map[string]interface{}{"name": "b", "v": 2}},
+		map[string]interface{}{"$merge": map[string]interface{}{"name": "a", "v": 3}},
+	}
+	err := m.merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "v": 3},
+		map[string]interface{}{"name": "b", "v": 2},
+	}, toData)
+}
+
+func TestResolve(t *testing.T) {
+	data := map[string]interface{}{
+		"a": map[string]interface{}{"$delete": true},
+		"b": []interface{}{map[string]interface{}{"$replace": 1}, map[string]interface{}{"$delete": true}},
+		"c": map[string]interface{}{"$strategy": "append", "$merge": []map[string]interface{}{{"d": 1}}},
+	}
+	out, ok, err := resolve(rootContext(), data)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{
+		"b": []interface{}{1},
+		"c": []interface{}{map[string]interface{}{"d": 1}},
+	}, out)
+	assert.Contains(t, data, "a")
+}
@@ -18,7 +18,7 @@ func wrapError(err error, msg string, args ...interface{}) error {
 	if err == nil {
 		return nil
 	}
-	return makeError("%v : %v", makeError(msg, args...), err)
+	return makeError("%v : %w", makeError(msg, args...), err)
 }
 
 func detailError(err error, msg string, args ...interface{}) error {
@@ -11,7 +11,13 @@ type filedata struct {
 	url      pkgurl.URL
 	data     []byte
 	obj      map[string]interface{}
-	includes []string
+	ops      []interface{}
+	patch    patchKind
+	includes []include
+	// at is the json pointer tokens of the object the data is merged into, see include
+	at []string
+	// walk refers to the data of an include that is loaded once, see claimWalk
+	walk *walk
 }
 
 var emptyFiledata = filedata{}
@@ -38,9 +44,39 @@ var Unmarshallers = UnmarshallerMap{
 	"":      {JSONUnmarshal, YAMLUnmarshal, TOMLUnmarshal},
 }
 
+// MergePatchSuffix is the file name suffix, before the format extension, of files that are applied as an RFC 7386 JSON Merge Patch, e.g. "prod.merge-patch.yaml"
+var MergePatchSuffix = ".merge-patch"
+
+// JSONPatchSuffix is the file name suffix, before the format extension, of files that are applied as an RFC 6902 JSON Patch, e.g. "prod.patch.json".
+// Files with the suffix that do not contain an array are merged as data.
+var JSONPatchSuffix = ".patch"
+
 func newFiledata(data []byte, url pkgurl.URL) (filedata, error) {
-	fd := filedata{data: data, url: url}
-	err := fd.unmarshal()
+	return unmarshalFiledata(data, url, noPatch)
+}
+
+// newPatchFiledata unmarshals a file that is applied as a patch, see ApplyPatchFiles, which is a JSON Merge Patch unless it is
+// a JSON Patch
+func newPatchFiledata(data []byte, url pkgurl.URL) (filedata, error) {
+	return unmarshalFiledata(data, url, mergePatchKind)
+}
+
+// unmarshalFiledata unmarshals the data of the url as a JSON Patch when it is an array, and the url has the JSONPatchSuffix or
+// the kind is a merge patch. Otherwise the data is an object, which is a JSON Merge Patch when the url has the MergePatchSuffix,
+// and is otherwise of the kind, so that an object named with the JSONPatchSuffix, e.g. "app.patch.yaml", is not a JSON Patch.
+func unmarshalFiledata(data []byte, url pkgurl.URL, kind patchKind) (filedata, error) {
+	fd := filedata{data: data, url: url, patch: patchKindOf(url)}
+	if fd.patch == jsonPatchKind || (fd.patch == noPatch && kind == mergePatchKind) {
+		if fd.unmarshal(&fd.ops) == nil {
+			fd.patch = jsonPatchKind
+			return fd, nil
+		}
+		fd.patch, fd.ops = noPatch, nil
+	}
+	if fd.patch == noPatch {
+		fd.patch = kind
+	}
+	err := fd.unmarshal(&fd.obj)
 	if err != nil {
 		return emptyFiledata, err
 	}
@@ -63,14 +99,25 @@ func (fd *filedata) wrapError(err error) error {
 	if fd.url == emptyURL {
 		return err
 	}
-	return wrapError(err, "Error processing %v", fd.url.String())
+	return wrapError(err, "Error processing %v", fd.url.Redacted())
 }
 
 func (fd *filedata) validate() error {
 	return fd.wrapError(validate(fd.obj, getSchema()))
 }
 
-func (fd *filedata) unmarshal() error {
+func patchKindOf(url pkgurl.URL) patchKind {
+	name := strings.ToLower(strings.TrimSuffix(url.Path, filepath.Ext(url.Path)))
+	switch {
+	case MergePatchSuffix != "" && strings.HasSuffix(name, MergePatchSuffix):
+		return mergePatchKind
+	case JSONPatchSuffix != "" && strings.HasSuffix(name, JSONPatchSuffix):
+		return jsonPatchKind
+	}
+	return noPatch
+}
+
+func (fd *filedata) unmarshal(out interface{}) error {
 	ext := strings.ToLower(filepath.Ext(fd.url.Path))
 	unmarshallers, ok := Unmarshallers[ext]
 	if !ok {
@@ -78,7 +125,7 @@ func (fd *filedata) unmarshal() error {
 	}
 	err := makeError("Could not unmarshal data")
 	for _, unmarshal := range unmarshallers {
-		uerr := unmarshal(fd.data, &fd.obj)
+		uerr := unmarshal(fd.data, out)
 		if uerr == nil {
 			return nil
 		}
@@ -91,14 +138,58 @@ func (fd *filedata) extractIncludes() error {
 	if Includes == "" {
 		return nil
 	}
-	err := jsonMarshalUnmarshal(fd.obj[Includes], &fd.includes)
+	var includes []include
+	err := jsonMarshalUnmarshal(fd.obj[Includes], &includes)
 	if err != nil {
 		return wrapError(err, "Could not extract includes")
 	}
+	for _, include := range includes {
+		if include.enabled() {
+			fd.includes = append(fd.includes, include)
+		}
+	}
 	delete(fd.obj, Includes)
 	return nil
 }
 
+// mounted returns the data with its values, or the paths of its json patch operations, moved under the mount point
+func (fd filedata) mounted() filedata {
+	if len(fd.at) == 0 {
+		return fd
+	}
+	if fd.patch == jsonPatchKind {
+		fd.ops = mountOps(fd.at, fd.ops)
+		return fd
+	}
+	var obj interface{} = fd.obj
+	for i := len(fd.at) - 1; i > 0; i-- {
+		obj = map[string]interface{}{fd.at[i]: obj}
+	}
+	fd.obj = map[string]interface{}{fd.at[0]: obj}
+	return fd
+}
+
+func mountOps(at []string, ops []interface{}) []interface{} {
+	prefix := formatPointer(at)
+	mounted := make([]interface{}, len(ops))
+	for i, op := range ops {
+		props, ok := op.(map[string]interface{})
+		if !ok {
+			mounted[i] = op
+			continue
+		}
+		mountedOp := make(map[string]interface{}, len(props))
+		for name, value := range props {
+			if pointer, ok := value.(string); ok && (name == "path" || name == "from") {
+				value = prefix + pointer
+			}
+			mountedOp[name] = value
+		}
+		mounted[i] = mountedOp
+	}
+	return mounted
+}
+
 func (fds filedatas) objs() []interface{} {
 	var objs []interface{}
 	for _, fd := range fds {
@@ -108,7 +199,7 @@ func (fds filedatas) objs() []interface{} {
 }
 
 func (fd *filedata) isEmpty() bool {
-	return fd == nil || fd.obj == nil
+	return fd == nil || (fd.obj == nil && fd.ops == nil)
 }
 
 func recursiveExpand(b []byte) []byte {
@@ -147,7 +238,23 @@ func getDefaultSchema() map[string]interface{} {
 					Includes: map[string]interface{}{
 						"type": "array",
 						"items": map[string]interface{}{
-							"type": "string",
+							"anyOf": []interface{}{
+								map[string]interface{}{
+									"type": "string",
+								},
+								map[string]interface{}{
+									"type":     "object",
+									"required": []interface{}{"path"},
+									"properties": map[string]interface{}{
+										"path":     map[string]interface{}{"type": "string"},
+										"optional": map[string]interface{}{"type": "boolean"},
+										"if":       map[string]interface{}{"type": "string"},
+										"at":       map[string]interface{}{"type": "string", "pattern": "^(/|$)"},
+										"sha256":   map[string]interface{}{"type": "string", "pattern": "^[0-9a-fA-F]{64}$"},
+									},
+									"additionalProperties": false,
+								},
+							},
 						},
 					},
 				},
@@ -159,7 +159,7 @@ func TestFiledata_NullIncludes(t *testing.T) {
 func TestFiledata_Includes(t *testing.T) {
 	fd, err := testLoader.wrapFiledata([]byte(`{"includes":["test1", "test2"], "x": 1}`))
 	assert.Nil(t, err)
-	assert.Equal(t, fd.includes, []string{"test1", "test2"})
+	assert.Equal(t, fd.includes, []include{{Path: "test1"}, {Path: "test2"}})
 	assert.Nil(t, fd.obj[Includes])
 	assert.Equal(t, fd.obj, map[string]interface{}{"x": 1.0})
 }
@@ -213,7 +213,7 @@ func TestFiledatas_DifferentIncludes(t *testing.T) {
 	defer func() { Includes = old }()
 	fd, err := testLoader.wrapFiledata([]byte(`{"using":["test1", "test2"], "x": 1}`))
 	assert.Nil(t, err)
-	assert.Equal(t, fd.includes, []string{"test1", "test2"})
+	assert.Equal(t, fd.includes, []include{{Path: "test1"}, {Path: "test2"}})
 	assert.Nil(t, fd.obj[Includes])
 	assert.Equal(t, fd.obj, map[string]interface{}{"x": 1.0})
 }
@@ -237,3 +237,16 @@ func TestFiledatas_IgnoreIncludes(t *testing.T) {
 	assert.Empty(t, fd.includes)
 	assert.Equal(t, fd.obj, map[string]interface{}{"": []interface{}{"test1", "test2"}})
 }
+
+func TestFiledata_PatchKind(t *testing.T) {
+	assert.Equal(t, noPatch, testFiledataNewAssert(t, testMarshalJSON, "file.json").patch)
+	fd := testFiledataNewAssert(t, []byte(`{"x": null}`), "file.merge-patch.json")
+	assert.Equal(t, mergePatchKind, fd.patch)
+	assert.Equal(t, map[string]interface{}{"x": nil}, fd.obj)
+	fd = testFiledataNewAssert(t, []byte(`[{"op": "remove", "path": "/x"}]`), "FILE.PATCH.JSON")
+	assert.Equal(t, jsonPatchKind, fd.patch)
+	assert.Equal(t, 1, len(fd.ops))
+	assert.False(t, fd.isEmpty())
+	_, err := testFiledataNew(t, []byte(`{bad`), "file.patch.json")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,42 @@
+package conflate
+
+import (
+	gocontext "context"
+	"errors"
+	"io/fs"
+	pkgurl "net/url"
+	"strconv"
+	"strings"
+)
+
+// fsScheme is the url scheme of files loaded from an fs.FS, where the host is the index of the fs.FS in the fsHandler
+const fsScheme = "fs"
+
+type fsHandler []fs.FS
+
+func (h *fsHandler) add(fsys fs.FS) pkgurl.URL {
+	*h = append(*h, fsys)
+	return pkgurl.URL{Scheme: fsScheme, Host: strconv.Itoa(len(*h) - 1), Path: "/"}
+}
+
+func (h *fsHandler) Load(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	i, err := strconv.Atoi(url.Host)
+	if err != nil || i < 0 || i >= len(*h) {
+		return nil, makeError("The file system is not known : %v", url.Redacted())
+	}
+	return fs.ReadFile((*h)[i], strings.TrimPrefix(url.Path, "/"))
+}
+
+// fallthroughFS opens files missing from the first file system from the second
+type fallthroughFS struct {
+	first  fs.FS
+	second fs.FS
+}
+
+func (f fallthroughFS) Open(name string) (fs.File, error) {
+	file, err := f.first.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f.second.Open(name)
+	}
+	return file, err
+}
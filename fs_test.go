@@ -0,0 +1,70 @@
+package conflate
+
+import (
+	gocontext "context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFS = fstest.MapFS{
+	"config/parent.json":   {Data: []byte(`{"includes": ["child.yaml", "../shared/sibling.json"], "parent": true}`)},
+	"config/child.yaml":    {Data: []byte(`child: true`)},
+	"shared/sibling.json":  {Data: []byte(`{"sibling": true}`)},
+	"config/absolute.json": {Data: []byte(`{"includes": ["/shared/sibling.json"]}`)},
+	"config/missing.json":  {Data: []byte(`{"includes": ["local.json"]}`)},
+}
+
+func TestFromFS(t *testing.T) {
+	c, err := FromFS(testFS, "config/parent.json")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"parent": true, "child": true, "sibling": true}, c.data)
+	assert.Equal(t, "fs://0/config/child.yaml", c.Provenance("#/child")[0].URL)
+}
+
+func TestFromFS_Absolute(t *testing.T) {
+	c, err := FromFS(testFS, "/config/absolute.json")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"sibling": true}, c.data)
+}
+
+func TestFromFS_Missing(t *testing.T) {
+	_, err := FromFS(testFS, "config/missing.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "file does not exist")
+}
+
+func TestAddFS_SeparateFileSystems(t *testing.T) {
+	c := New()
+	err := c.AddFS(testFS, "config/child.yaml")
+	assert.Nil(t, err)
+	err = c.AddFS(fstest.MapFS{"config/child.yaml": {Data: []byte(`other: true`)}}, "config/child.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"child": true, "other": true}, c.data)
+}
+
+func TestAddFS_Fallthrough(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "config"), 0755)
+	assert.Nil(t, err)
+	err = os.WriteFile(filepath.Join(dir, "config", "local.json"), []byte(`{"local": true}`), 0644)
+	assert.Nil(t, err)
+	c := New(WithFSFallthrough(dir))
+	err = c.AddFS(testFS, "config/missing.json")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"local": true}, c.data)
+}
+
+func TestFSHandler_UnknownFS(t *testing.T) {
+	var h fsHandler
+	_, err := h.Load(gocontext.Background(), h.add(testFS))
+	assert.NotNil(t, err)
+	root := h.add(testFS)
+	root.Host = "9"
+	_, err = h.Load(gocontext.Background(), root)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The file system is not known : fs://9/")
+}
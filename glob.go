@@ -0,0 +1,108 @@
+package conflate
+
+import (
+	pkgurl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandURLs replaces each file url that is a glob pattern, or a directory, with the urls of the matching data files, see expandURL
+func (l *loader) expandURLs(parent *pkgurl.URL, urls []pkgurl.URL) ([]pkgurl.URL, error) {
+	var expanded []pkgurl.URL
+	for _, url := range urls {
+		fileURLs, err := l.expandURL(parent, url)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, fileURLs...)
+	}
+	return expanded, nil
+}
+
+// expandURL returns the urls of the data files matching a file url that is a glob pattern, or a directory, in lexical order, or else the url.
+// The parent url is left out of the matches, so a file can include the other files in its directory.
+func (l *loader) expandURL(parent *pkgurl.URL, url pkgurl.URL) ([]pkgurl.URL, error) {
+	files, ok, err := globFiles(url)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return []pkgurl.URL{url}, nil
+	}
+	if len(files) == 0 && l.globRequired {
+		return nil, makeError("No files match the include pattern : %v", url.Redacted())
+	}
+	var expanded []pkgurl.URL
+	for _, file := range files {
+		fileURL := url
+		fileURL.Path, fileURL.RawPath = setPath(file), ""
+		if parent != nil && fileURL == *parent {
+			continue
+		}
+		expanded = append(expanded, fileURL)
+	}
+	return expanded, nil
+}
+
+// globFiles returns the data files matching a file url that is a glob pattern or a directory, and false for any other url,
+// including a pattern without a * wildcard that matches no files, so that it is loaded, and reported as missing, as a file
+func globFiles(url pkgurl.URL) ([]string, bool, error) {
+	if url.Scheme != "file" {
+		return nil, false, nil
+	}
+	path := getPath(url.Path)
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return dirFiles(path)
+	case err == nil || !isGlob(path):
+		return nil, false, nil
+	}
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, false, wrapError(err, "Could not match the include pattern : %v", url.Redacted())
+	}
+	sort.Strings(matches)
+	hidden := strings.HasPrefix(filepath.Base(path), ".")
+	var files []string
+	for _, match := range matches {
+		// like a shell, hidden files are only matched by a pattern starting with a dot
+		if !hidden && strings.HasPrefix(filepath.Base(match), ".") {
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 && !strings.Contains(path, "*") {
+		// a path matching nothing without a wildcard, e.g. "app[1].json", is more likely a missing file than a pattern
+		return nil, false, nil
+	}
+	return files, true, nil
+}
+
+// dirFiles returns the files in the directory with an extension in Unmarshallers, skipping hidden files and sub directories
+func dirFiles(dir string) ([]string, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, false, wrapError(err, "Could not read the include directory : %v", dir)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || strings.HasPrefix(name, ".") || ext == "" {
+			continue
+		}
+		if _, ok := Unmarshallers[ext]; ok {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, true, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
@@ -0,0 +1,128 @@
+package conflate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGlobDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(path, []byte(content), 0o644)
+		assert.Nil(t, err)
+	}
+	return dir
+}
+
+func testGlobFiles() map[string]string {
+	return map[string]string{
+		"conf.d/20-b.yaml":   "order: [b]\nb: 2\n",
+		"conf.d/10-a.json":   `{"order": ["a"], "a": 1}`,
+		"conf.d/30-c.yaml":   "order: [c]\nc: 3\n",
+		"conf.d/README":      "not data",
+		"conf.d/.hidden.yml": "order: [hidden]\n",
+		"conf.d/sub/x.yaml":  "order: [sub]\n",
+	}
+}
+
+func TestAddFiles_Glob(t *testing.T) {
+	dir := testGlobDir(t, testGlobFiles())
+	c := New()
+	err := c.AddFiles(filepath.Join(dir, "conf.d", "*.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "c"}, data["order"])
+}
+
+func TestAddFiles_Directory(t *testing.T) {
+	dir := testGlobDir(t, testGlobFiles())
+	c := New()
+	err := c.AddFiles(filepath.Join(dir, "conf.d"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, data["order"])
+	assert.Equal(t, int64(1), data["a"])
+	assert.Equal(t, int64(3), data["c"])
+}
+
+func TestIncludes_Glob(t *testing.T) {
+	files := testGlobFiles()
+	files["main.yaml"] = "includes: ['conf.d/*.*']\norder: [main]\n"
+	dir := testGlobDir(t, files)
+	c, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c", "main"}, data["order"])
+}
+
+func TestIncludes_GlobSkipsParent(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"a.yaml": "includes: ['*.yaml']\norder: [a]\n",
+		"b.yaml": "order: [b]\n",
+	})
+	c, err := FromFiles(filepath.Join(dir, "a.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "a"}, data["order"])
+}
+
+func TestAddFiles_MissingBrackets(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{"app[1].json": `{"x": 1}`})
+	c := New()
+	err := c.AddFiles(filepath.Join(dir, "app[1].json"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": int64(1)}, c.data)
+	err = c.AddFiles(filepath.Join(dir, "missing[1].json"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing[1].json")
+}
+
+func TestIncludes_GlobNoMatch(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{"main.yaml": "includes: ['conf.d/*.yaml']\nx: 1\n"})
+	c, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), data["x"])
+
+	c = New(WithGlobMatchRequired(true))
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No files match the include pattern : file://")
+}
+
+func TestIncludes_GlobPolicy(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"user/main.yaml": "includes: ['../*.yaml']\n",
+		"secret.yaml":    "x: 1\n",
+	})
+	c := New(WithIncludePolicy(IncludePolicy{Roots: []string{filepath.Join(dir, "user")}}))
+	err := c.AddFiles(filepath.Join(dir, "user", "main.yaml"))
+	policyErr := testPolicyError(t, err)
+	assert.Contains(t, policyErr.Include, "secret.yaml")
+}
+
+func TestGlobFiles_Literal(t *testing.T) {
+	url, err := toURL(nil, "testdata/valid_parent.json")
+	assert.Nil(t, err)
+	files, ok, err := globFiles(url)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, files)
+}
@@ -0,0 +1,24 @@
+package conflate
+
+import "time"
+
+// IncludeNode is a file, or data, in the include graph, see Conflate.IncludeGraph
+type IncludeNode struct {
+	// URL is the url of the file, which is blank for data
+	URL string `json:"url"`
+	// Depth is the number of files that include the file, which is 0 for the files and data added to the Conflate instance
+	Depth int `json:"depth"`
+	// Duration is the time taken to load the file, excluding its includes, in nanoseconds in JSON
+	Duration time.Duration `json:"duration"`
+	// Includes are the files included by the file, in the order they are merged, which is before the file itself
+	Includes []*IncludeNode `json:"includes,omitempty"`
+	// skipped is set for an optional include that does not exist
+	skipped bool
+	// mount is the json pointer tokens of the object the file is merged into, including the mount points of its parents
+	mount []string
+}
+
+// IncludeGraph returns the files and data added to the Conflate instance, in the order they were added, with the files they include
+func (c *Conflate) IncludeGraph() []*IncludeNode {
+	return append([]*IncludeNode{}, c.graph...)
+}
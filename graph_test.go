@@ -0,0 +1,89 @@
+package conflate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGraph returns the urls of the nodes relative to the directory, nested as in the graph, with their depth
+func testGraph(t *testing.T, dir string, nodes []*IncludeNode) []interface{} {
+	var graph []interface{}
+	for _, node := range nodes {
+		assert.True(t, node.Duration >= 0)
+		url := node.URL
+		if url != "" {
+			rel, err := filepath.Rel(dir, url[len("file://"):])
+			assert.Nil(t, err)
+			url = rel
+		}
+		entry := []interface{}{url, node.Depth}
+		if len(node.Includes) > 0 {
+			entry = append(entry, testGraph(t, dir, node.Includes))
+		}
+		graph = append(graph, entry)
+	}
+	return graph
+}
+
+func TestConflate_IncludeGraph(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml":        "includes: [conf.d, {path: local.yaml, optional: true}, shared.yaml]\n",
+		"conf.d/1.yaml":    "includes: [../shared.yaml]\n",
+		"conf.d/2.yaml":    "x: 2\n",
+		"shared.yaml":      "includes: [base.yaml]\n",
+		"base.yaml":        "x: 0\n",
+		"other.yaml":       "x: 3\n",
+		"conf.d/.ignored":  "x: 4\n",
+		"conf.d/empty.yml": "",
+	})
+	c := New()
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"), filepath.Join(dir, "other.yaml"))
+	assert.Nil(t, err)
+	err = c.AddData([]byte(`{"includes": ["` + filepath.Join(dir, "base.yaml") + `"]}`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []interface{}{
+		[]interface{}{"main.yaml", 0, []interface{}{
+			[]interface{}{"conf.d/1.yaml", 1, []interface{}{
+				[]interface{}{"shared.yaml", 2, []interface{}{
+					[]interface{}{"base.yaml", 3},
+				}},
+			}},
+			[]interface{}{"conf.d/2.yaml", 1},
+			[]interface{}{"conf.d/empty.yml", 1},
+			[]interface{}{"shared.yaml", 1, []interface{}{
+				[]interface{}{"base.yaml", 2},
+			}},
+		}},
+		[]interface{}{"other.yaml", 0},
+		[]interface{}{"", 0, []interface{}{
+			[]interface{}{"base.yaml", 1},
+		}},
+	}, testGraph(t, dir, c.IncludeGraph()))
+}
+
+func TestConflate_IncludeGraphSequential(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml": "includes: [a.yaml, b.yaml]\n",
+		"a.yaml":    "a: 1\n",
+		"b.yaml":    "b: 1\n",
+	})
+	c := New(WithConcurrency(1))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		[]interface{}{"main.yaml", 0, []interface{}{
+			[]interface{}{"a.yaml", 1},
+			[]interface{}{"b.yaml", 1},
+		}},
+	}, testGraph(t, dir, c.IncludeGraph()))
+}
+
+func TestConflate_IncludeGraphError(t *testing.T) {
+	c := New()
+	err := c.AddFiles("testdata/missing_file_in_include.json")
+	assert.NotNil(t, err)
+	assert.Empty(t, c.IncludeGraph())
+}
@@ -0,0 +1,112 @@
+package conflate
+
+import (
+	gocontext "context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	pkgurl "net/url"
+	"time"
+)
+
+// httpLoader loads http and https urls, optionally through an on-disk cache
+type httpLoader struct {
+	client  *http.Client
+	cache   *httpCache
+	offline bool
+	policy  *IncludePolicy
+}
+
+func (h *httpLoader) Load(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	if h.cache == nil {
+		if h.offline {
+			return nil, makeError("The offline mode requires an http cache : %v", url.Redacted())
+		}
+		return h.loadUncached(ctx, url)
+	}
+	entry, body := h.cache.read(url)
+	if entry != nil && (h.offline || time.Now().Before(entry.Expires)) {
+		return body, nil
+	}
+	if h.offline {
+		return nil, makeError("The url is not in the http cache for the offline mode : %v", url.Redacted())
+	}
+	return h.loadCached(ctx, url, entry, body)
+}
+
+func (h *httpLoader) loadUncached(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	resp, err := h.get(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{status: resp.StatusCode, url: url.Redacted()}
+	}
+	return data, err
+}
+
+// loadCached revalidates any cached body, which is also served when the host cannot be reached or has a server error.
+// Failing to write the cache does not fail the load, as the cache is only an optimisation, like failing to read it.
+func (h *httpLoader) loadCached(ctx gocontext.Context, url pkgurl.URL, entry *cacheEntry, body []byte) ([]byte, error) {
+	resp, err := h.get(ctx, url, entry)
+	if err != nil {
+		if entry != nil && ctx.Err() == nil {
+			return body, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		_ = h.cache.write(url, newCacheEntry(url, resp.Header, entry), nil)
+		return body, nil
+	case resp.StatusCode == http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if noStore(resp.Header) {
+			return data, nil
+		}
+		_ = h.cache.write(url, newCacheEntry(url, resp.Header, nil), data)
+		return data, nil
+	case resp.StatusCode >= http.StatusInternalServerError && entry != nil:
+		return body, nil
+	}
+	return nil, &statusError{status: resp.StatusCode, url: url.Redacted()}
+}
+
+// statusError is the error for an http response that is not successful, which matches fs.ErrNotExist when the url is not found
+type statusError struct {
+	status int
+	url    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Failed to load url : %v : %v", e.status, e.url)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == fs.ErrNotExist && (e.status == http.StatusNotFound || e.status == http.StatusGone)
+}
+
+func (h *httpLoader) get(ctx gocontext.Context, url pkgurl.URL, entry *cacheEntry) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry != nil && entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	client := h.client
+	if h.policy != nil {
+		client = &http.Client{Transport: h.client.Transport, CheckRedirect: h.policy.checkRedirect, Jar: h.client.Jar, Timeout: h.client.Timeout}
+	}
+	return client.Do(req)
+}
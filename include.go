@@ -0,0 +1,52 @@
+package conflate
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// include is an entry of an includes array, which is either a path, or an object with the path and how it is included
+type include struct {
+	Path string `json:"path"`
+	// Optional skips the include when its file does not exist
+	Optional bool `json:"optional,omitempty"`
+	// If skips the include unless the condition is true, e.g. "${ENV} == prod"
+	If string `json:"if,omitempty"`
+	// At is the json pointer of the object the included data is merged into, e.g. "/replica"
+	At string `json:"at,omitempty"`
+	// SHA256 is the hex encoded sha256 digest that the data of the file must match, so the path must not match more than one file
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func (i *include) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &i.Path); err == nil {
+		return nil
+	}
+	type object include
+	return json.Unmarshal(b, (*object)(i))
+}
+
+// enabled evaluates the condition of the include, which compares two values with == or !=, or is a single value that
+// is true unless blank, "false" or "0". Environment variables in the values are expanded, where unset variables are blank.
+func (i include) enabled() bool {
+	if strings.TrimSpace(i.If) == "" {
+		return true
+	}
+	if lhs, rhs, ok := strings.Cut(i.If, "!="); ok {
+		return conditionValue(lhs) != conditionValue(rhs)
+	}
+	if lhs, rhs, ok := strings.Cut(i.If, "=="); ok {
+		return conditionValue(lhs) == conditionValue(rhs)
+	}
+	value := conditionValue(i.If)
+	return value != "" && value != "false" && value != "0"
+}
+
+func conditionValue(s string) string {
+	s = strings.TrimSpace(os.ExpandEnv(s))
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+package conflate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInclude_Enabled(t *testing.T) {
+	os.Setenv("CONFLATE_TEST_ENV", "prod")
+	defer os.Unsetenv("CONFLATE_TEST_ENV")
+	for condition, enabled := range map[string]bool{
+		"":                                true,
+		"${CONFLATE_TEST_ENV} == prod":    true,
+		"${CONFLATE_TEST_ENV} == 'prod'":  true,
+		"$CONFLATE_TEST_ENV == dev":       false,
+		"${CONFLATE_TEST_ENV} != prod":    false,
+		"${CONFLATE_TEST_UNSET} == ''":    true,
+		"${CONFLATE_TEST_ENV}":            true,
+		"${CONFLATE_TEST_UNSET}":          false,
+		"false":                           false,
+		"0":                               false,
+		"${CONFLATE_TEST_UNSET} != prod ": true,
+	} {
+		assert.Equal(t, enabled, include{Path: "x", If: condition}.enabled(), condition)
+	}
+}
+
+func TestFiledata_IncludeObjects(t *testing.T) {
+	fd, err := testLoader.wrapFiledata([]byte(`{"includes":["a", {"path": "b", "optional": true}, {"path": "c", "if": "x == y"}, {"path": "d", "if": "x == x"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []include{{Path: "a"}, {Path: "b", Optional: true}, {Path: "d", If: "x == x"}}, fd.includes)
+}
+
+func TestFiledata_IncludeObjectsInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"includes":[{"optional": true}]}`,
+		`{"includes":[{"path": "a", "optional": "yes"}]}`,
+		`{"includes":[{"path": "a", "unknown": 1}]}`,
+		`{"includes":[1]}`,
+	} {
+		_, err := testLoader.wrapFiledata([]byte(data))
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "not valid against the schema", data)
+	}
+}
+
+func TestIncludes_Optional(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml":  "includes: [{path: local.yaml, optional: true}, {path: missing.yaml, optional: true}]\nx: main\n",
+		"local.yaml": "x: local\nz: local\n",
+	})
+	c, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": "main", "z": "local"}, data)
+}
+
+func TestIncludes_OptionalMissingNestedInclude(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml":  "includes: [{path: local.yaml, optional: true}]\n",
+		"local.yaml": "includes: [missing.yaml]\n",
+	})
+	_, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing.yaml")
+}
+
+func TestIncludes_OptionalInvalid(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml":  "includes: [{path: local.yaml, optional: true}]\n",
+		"local.yaml": "x: [\n",
+	})
+	_, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not unmarshal data")
+}
+
+func TestIncludes_OptionalHTTPNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	c := New()
+	err := c.AddData([]byte(`{"includes": [{"path": "` + server.URL + `/missing.json", "optional": true}], "x": 1}`))
+	assert.Nil(t, err)
+	err = c.AddData([]byte(`{"includes": ["` + server.URL + `/missing.json"]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Failed to load url : 404")
+}
+
+func TestIncludes_If(t *testing.T) {
+	os.Setenv("CONFLATE_TEST_ENV", "prod")
+	defer os.Unsetenv("CONFLATE_TEST_ENV")
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml": "includes: [{path: prod.yaml, if: '${CONFLATE_TEST_ENV} == prod'}, {path: dev.yaml, if: '${CONFLATE_TEST_ENV} == dev'}]\n",
+		"prod.yaml": "env: prod\n",
+	})
+	c, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, data)
+}
+
+func TestIncludes_At(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.yaml": "includes: [{path: database.json, at: /primary}, {path: database.json, at: /replica}]\nreplica:\n  host: replica.local\n",
+		"database.json": `{
+  "includes": [{"path": "pool.json", "at": "/pool"}],
+  "host": "primary.local",
+  "port": 5432
+}`,
+		"pool.json": `{"size": 10}`,
+	})
+	c, err := FromFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"primary": map[string]interface{}{"host": "primary.local", "port": int64(5432), "pool": map[string]interface{}{"size": int64(10)}},
+		"replica": map[string]interface{}{"host": "replica.local", "port": int64(5432), "pool": map[string]interface{}{"size": int64(10)}},
+	}, data)
+
+	sources := c.Provenance("#/replica/port")
+	assert.Equal(t, 1, len(sources))
+	assert.Contains(t, sources[0].URL, "database.json")
+	assert.Equal(t, 4, sources[0].Line)
+}
+
+func TestIncludes_AtPatch(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"main.json":           `{"includes": ["base.json", {"path": "db.patch.json", "at": "/db"}, {"path": "db.merge-patch.json", "at": "/db"}]}`,
+		"base.json":           `{"db": {"host": "a", "port": 1}}`,
+		"db.patch.json":       `[{"op": "replace", "path": "/host", "value": "b"}, {"op": "copy", "from": "/port", "path": "/copy"}]`,
+		"db.merge-patch.json": `{"port": null}`,
+	})
+	c, err := FromFiles(filepath.Join(dir, "main.json"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"db": map[string]interface{}{"host": "b", "copy": int64(1)}}, data)
+}
+
+func TestFiledata_IncludeAtInvalid(t *testing.T) {
+	_, err := testLoader.wrapFiledata([]byte(`{"includes":[{"path": "a", "at": "replica"}]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not valid against the schema")
+}
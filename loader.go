@@ -1,6 +1,10 @@
 package conflate
 
 import (
+	gocontext "context"
+	"crypto/ed25519"
+	"errors"
+	"io/fs"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -9,6 +13,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,54 +24,263 @@ var (
 	driveLetter = regexp.MustCompile(`^[A-Za-z]:.*$`)
 )
 
+// SchemeHandler loads the data at urls of the scheme it is registered for, see Conflate.RegisterScheme.
+// Sibling includes are loaded concurrently, so Load may be called from multiple goroutines at once.
+type SchemeHandler interface {
+	Load(ctx gocontext.Context, url pkgurl.URL) ([]byte, error)
+}
+
+// SchemeHandlerFunc allows a function to be registered as a SchemeHandler
+type SchemeHandlerFunc func(ctx gocontext.Context, url pkgurl.URL) ([]byte, error)
+
+// Load calls the function with the url
+func (f SchemeHandlerFunc) Load(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	return f(ctx, url)
+}
+
+var defaultHTTPLoader = &httpLoader{client: &http.Client{Transport: newTransport()}}
+
+var defaultSchemeHandlers = map[string]SchemeHandler{
+	"file":  SchemeHandlerFunc(loadFileURL),
+	"http":  defaultHTTPLoader,
+	"https": defaultHTTPLoader,
+}
+
 type loader struct {
 	newFiledata func([]byte, pkgurl.URL) (filedata, error)
+	handlers    map[string]SchemeHandler
+	// workers bounds the number of urls fetched at once, loading sibling urls sequentially when nil
+	workers chan struct{}
+	policy  *IncludePolicy
+	// globRequired fails a glob pattern, or directory, that matches no files
+	globRequired bool
+	digests      *digests
+	trustedKeys  []ed25519.PublicKey
+	dedupe       Dedupe
+	// maxDepth and maxFiles limit the depth of includes, and the number of files loaded by each call, when positive
+	maxDepth int
+	maxFiles int
+}
+
+func newWorkers(n int) chan struct{} {
+	if n <= 1 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// errOptionalMissing is returned by loadFiledata for an optional include whose url does not exist, and never by the verification of its data
+var errOptionalMissing = errors.New("The optional include does not exist")
+
+// includeURL is the url of an include, see include
+type includeURL struct {
+	url      pkgurl.URL
+	optional bool
+	at       []string
+	sha256   string
+	// patch loads the url as a patch, see newPatchFiledata
+	patch bool
+	// node records the loading of the url in the include graph
+	node *IncludeNode
+}
+
+// loadURLsRecursive loads the urls, and their includes, adding them to the include graph under the parent, which may be nil
+func (l *loader) loadURLsRecursive(ctx gocontext.Context, parent *IncludeNode, urls ...pkgurl.URL) (filedatas, error) {
+	return l.loadRootsRecursive(ctx, parent, false, urls)
+}
+
+// loadPatchURLsRecursive loads the urls as patches, and their includes as any other file, adding them to the include graph under the parent
+func (l *loader) loadPatchURLsRecursive(ctx gocontext.Context, parent *IncludeNode, urls ...pkgurl.URL) (filedatas, error) {
+	return l.loadRootsRecursive(ctx, parent, true, urls)
+}
+
+func (l *loader) loadRootsRecursive(ctx gocontext.Context, parent *IncludeNode, patch bool, urls []pkgurl.URL) (filedatas, error) {
+	includes := make([]includeURL, len(urls))
+	for i, url := range urls {
+		includes[i] = includeURL{url: url, patch: patch}
+	}
+	data, err := l.loadIncludesRecursive(l.withLoadState(ctx), nil, parent, includes)
+	if err != nil {
+		return nil, err
+	}
+	return l.dedupeData(data)
 }
 
-func (l *loader) loadURLsRecursive(parentUrls []pkgurl.URL, urls ...pkgurl.URL) (filedatas, error) {
+func (l *loader) loadIncludesRecursive(ctx gocontext.Context, parentUrls []pkgurl.URL, parent *IncludeNode, includes []includeURL) (filedatas, error) {
+	if parent == nil {
+		parent = &IncludeNode{Depth: -1}
+	}
+	if l.maxDepth > 0 && parent.Depth >= l.maxDepth && len(includes) > 0 {
+		return nil, makeError("The include depth exceeds the maximum of %v : %v", l.maxDepth, includes[0].url.Redacted())
+	}
+	for i := range includes {
+		mount := append(append([]string{}, parent.mount...), includes[i].at...)
+		includes[i].node = &IncludeNode{URL: includes[i].url.Redacted(), Depth: parent.Depth + 1, mount: mount}
+	}
+	var results []filedatas
+	var err error
+	if l.workers == nil || len(includes) < 2 {
+		results, err = l.loadURLsSequential(ctx, parentUrls, includes)
+	} else {
+		results, err = l.loadURLsConcurrent(ctx, parentUrls, includes)
+	}
+	if err != nil {
+		return nil, err
+	}
 	var allData filedatas
-	for _, url := range urls {
-		data, err := l.loadURLRecursive(parentUrls, url)
+	for i, data := range results {
+		allData = append(allData, data...)
+		if !includes[i].node.skipped {
+			parent.Includes = append(parent.Includes, includes[i].node)
+		}
+	}
+	return allData, nil
+}
+
+func (l *loader) loadURLsSequential(ctx gocontext.Context, parentUrls []pkgurl.URL, includes []includeURL) ([]filedatas, error) {
+	results := make([]filedatas, len(includes))
+	for i, include := range includes {
+		data, err := l.loadURLRecursive(ctx, parentUrls, include)
 		if err != nil {
 			return nil, err
 		}
-		allData = append(allData, data...)
+		results[i] = data
 	}
-	return allData, nil
+	return results, nil
+}
+
+// loadURLsConcurrent loads the urls in parallel, returning the data of each url in the same order as the urls
+func (l *loader) loadURLsConcurrent(ctx gocontext.Context, parentUrls []pkgurl.URL, includes []includeURL) ([]filedatas, error) {
+	ctx, cancel := gocontext.WithCancel(ctx)
+	defer cancel()
+	results := make([]filedatas, len(includes))
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i, include := range includes {
+		wg.Add(1)
+		go func(i int, include includeURL) {
+			defer wg.Done()
+			data, err := l.loadURLRecursive(ctx, parentUrls, include)
+			if err != nil {
+				// the first error cancels the other urls, so is the cause of any later errors
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = data
+		}(i, include)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
 }
 
-func (l *loader) loadURLRecursive(parentUrls []pkgurl.URL, url pkgurl.URL) (filedatas, error) {
-	data, err := loadURL(url)
+func (l *loader) loadURLRecursive(ctx gocontext.Context, parentUrls []pkgurl.URL, include includeURL) (filedatas, error) {
+	w, first := l.claimWalk(ctx, include)
+	if !first {
+		return filedatas{{walk: w}}, nil
+	}
+	start := time.Now()
+	fdata, err := l.loadFiledata(ctx, include)
+	include.node.Duration = time.Since(start)
+	if err == errOptionalMissing {
+		include.node.skipped = true
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	fdata, err := l.newFiledata(data, url)
+	data, err := l.loadDatumRecursive(ctx, parentUrls, include.node, &include.url, fdata)
 	if err != nil {
 		return nil, err
 	}
-	return l.loadDatumRecursive(parentUrls, &url, fdata)
+	if w != nil {
+		for i := range data {
+			data[i].at = append(append([]string{}, include.node.mount...), data[i].at...)
+		}
+		w.data = data
+		return filedatas{{walk: w}}, nil
+	}
+	// the data and its own includes are merged under the mount point of the include
+	for i := range data {
+		data[i].at = append(append([]string{}, include.at...), data[i].at...)
+	}
+	return data, nil
+}
+
+func (l *loader) loadFiledata(ctx gocontext.Context, include includeURL) (filedata, error) {
+	data, err := l.loadVerified(ctx, include)
+	if err != nil {
+		return filedata{}, err
+	}
+	if include.patch {
+		fd, err := newPatchFiledata(data, include.url)
+		return fd, wrapError(err, "Could not unmarshal patch %v", include.url.Redacted())
+	}
+	return l.newFiledata(data, include.url)
+}
+
+// loadVerified loads the data at the url of the include, checking it against its digest, the lock and its signature.
+// It takes a worker while fetching the url, but not while loading its includes, which would otherwise wait on workers held by their parents.
+func (l *loader) loadVerified(ctx gocontext.Context, include includeURL) ([]byte, error) {
+	if err := l.countFile(ctx); err != nil {
+		return nil, err
+	}
+	if l.workers != nil {
+		select {
+		case l.workers <- struct{}{}:
+			defer func() { <-l.workers }()
+		case <-ctx.Done():
+			return nil, wrapError(ctx.Err(), "Failed to load url %v", include.url.Redacted())
+		}
+	}
+	data, err := l.fetchURL(ctx, include.url)
+	if include.optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, errOptionalMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = l.digests.verify(include, data)
+	if err != nil {
+		return nil, err
+	}
+	err = l.verifySignature(ctx, include.url, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-func (l *loader) loadDataRecursive(parentUrls []pkgurl.URL, data ...filedata) (filedatas, error) {
+// loadDataRecursive loads the includes of the data, adding the data to the include graph under the parent
+func (l *loader) loadDataRecursive(ctx gocontext.Context, parent *IncludeNode, data ...filedata) (filedatas, error) {
+	ctx = l.withLoadState(ctx)
 	var allData filedatas
 	for _, datum := range data {
-		childData, err := l.loadDatumRecursive(parentUrls, nil, datum)
+		node := &IncludeNode{Depth: parent.Depth + 1}
+		childData, err := l.loadDatumRecursive(ctx, nil, node, nil, datum)
 		if err != nil {
 			return nil, err
 		}
+		parent.Includes = append(parent.Includes, node)
 		allData = append(allData, childData...)
 	}
-	return allData, nil
+	return l.dedupeData(allData)
 }
 
-func (l *loader) loadDatumRecursive(parentUrls []pkgurl.URL, url *pkgurl.URL, data filedata) (filedatas, error) {
+func (l *loader) loadDatumRecursive(ctx gocontext.Context, parentUrls []pkgurl.URL, node *IncludeNode, url *pkgurl.URL, data filedata) (filedatas, error) {
 	if data.isEmpty() {
 		return nil, nil
 	}
 	if containsURL(url, parentUrls) {
-		return nil, makeError("The url recursively includes itself (%v)", url)
+		return nil, makeError("The url recursively includes itself (%v)", url.Redacted())
 	}
-	childUrls, err := toURLs(url, data.includes...)
+	includes, err := l.includeURLs(url, data.includes)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +289,7 @@ func (l *loader) loadDatumRecursive(parentUrls []pkgurl.URL, url *pkgurl.URL, da
 	if url != nil {
 		newParentUrls = append(newParentUrls, *url)
 	}
-	childData, err := l.loadURLsRecursive(newParentUrls, childUrls...)
+	childData, err := l.loadIncludesRecursive(ctx, newParentUrls, node, includes)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +299,36 @@ func (l *loader) loadDatumRecursive(parentUrls []pkgurl.URL, url *pkgurl.URL, da
 	return allData, nil
 }
 
+// includeURLs resolves the includes of the data at the url, expanding any glob patterns and directories, and checks them against the policy
+func (l *loader) includeURLs(url *pkgurl.URL, includes []include) ([]includeURL, error) {
+	var includeURLs []includeURL
+	for _, include := range includes {
+		childURL, err := toURL(url, include.Path)
+		if err != nil {
+			return nil, err
+		}
+		at, err := parsePointer(include.At)
+		if err != nil {
+			return nil, err
+		}
+		childURLs, err := l.expandURL(url, childURL)
+		if err != nil {
+			return nil, err
+		}
+		if include.SHA256 != "" && len(childURLs) > 1 {
+			return nil, makeError("The sha256 of an include can only pin a single file, but %v matches %v files", childURL.Redacted(), len(childURLs))
+		}
+		for _, childURL := range childURLs {
+			err = l.policy.check(url, childURL)
+			if err != nil {
+				return nil, err
+			}
+			includeURLs = append(includeURLs, includeURL{url: childURL, optional: include.Optional, at: at, sha256: include.SHA256})
+		}
+	}
+	return includeURLs, nil
+}
+
 func (l *loader) wrapFiledata(bytes []byte) (filedata, error) {
 	return l.newFiledata(bytes, emptyURL)
 }
@@ -101,25 +345,31 @@ func (l *loader) wrapFiledatas(bytes ...[]byte) (filedatas, error) {
 	return fds, nil
 }
 
-func loadURL(url pkgurl.URL) ([]byte, error) {
-	if url.Scheme == "file" {
-		// attempt to load locally handling case where we are loading from fifo etc
-		b, err := ioutil.ReadFile(getPath(url.Path))
-		if err == nil {
-			return b, nil
-		}
+func (l *loader) loadURL(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(err, "Failed to load url %v", url.Redacted())
 	}
-	client := http.Client{Transport: newTransport()}
-	resp, err := client.Get(url.String())
-	if err != nil {
-		return nil, err
+	handler, ok := l.handlers[url.Scheme]
+	if !ok {
+		handler, ok = defaultSchemeHandlers[url.Scheme]
 	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, makeError("Failed to load url : %v : %v", resp.StatusCode, url.String())
+	if !ok {
+		return nil, makeError("No handler is registered for the url scheme : %v : %v", url.Scheme, url.Redacted())
+	}
+	return handler.Load(ctx, url)
+}
+
+func loadURL(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	return (&loader{}).loadURL(ctx, url)
+}
+
+func loadFileURL(ctx gocontext.Context, url pkgurl.URL) ([]byte, error) {
+	// attempt to load locally handling case where we are loading from fifo etc
+	b, err := ioutil.ReadFile(getPath(url.Path))
+	if err == nil {
+		return b, nil
 	}
-	return data, err
+	return defaultHTTPLoader.Load(ctx, url)
 }
 
 func newTransport() *http.Transport {
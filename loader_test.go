@@ -2,9 +2,13 @@ package conflate
 
 import (
 	gocontext "context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -153,10 +157,190 @@ func TestToURLs(t *testing.T) {
 	assert.Equal(t, urls[2].Path, "/path/inside/three")
 }
 
+func testMemoryHandler(files map[string]string) SchemeHandler {
+	return SchemeHandlerFunc(func(ctx gocontext.Context, url url.URL) ([]byte, error) {
+		data, ok := files[url.Host+url.Path]
+		if !ok {
+			return nil, makeError("Not found : %v", url.String())
+		}
+		return []byte(data), nil
+	})
+}
+
+func TestLoader_RegisteredScheme(t *testing.T) {
+	l := loader{newFiledata: newFiledata, handlers: map[string]SchemeHandler{"mem": testMemoryHandler(map[string]string{
+		"config/parent.json": `{"includes": ["child.json"], "x": 1}`,
+		"config/child.json":  `{"y": 2}`,
+	})}}
+	u, err := url.Parse("mem://config/parent.json")
+	assert.Nil(t, err)
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, *u)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"y": int64(2)}, map[string]interface{}{"x": int64(1)}}, data.objs())
+	assert.Equal(t, "mem://config/child.json", data[0].url.String())
+}
+
+func TestLoader_RegisteredSchemeOverridesDefault(t *testing.T) {
+	l := loader{handlers: map[string]SchemeHandler{"https": testMemoryHandler(map[string]string{"example.com/a.json": `{}`})}}
+	data, err := l.loadURL(gocontext.Background(), url.URL{Scheme: "https", Host: "example.com", Path: "/a.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(data))
+}
+
+func TestLoader_UnknownScheme(t *testing.T) {
+	_, err := testLoader.loadURL(gocontext.Background(), url.URL{Scheme: "s3", Host: "bucket", Path: "/a.json"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No handler is registered for the url scheme : s3 : s3://bucket/a.json")
+}
+
+func TestLoader_Cancelled(t *testing.T) {
+	var loaded []string
+	l := loader{newFiledata: newFiledata, handlers: map[string]SchemeHandler{"mem": SchemeHandlerFunc(func(ctx gocontext.Context, url url.URL) ([]byte, error) {
+		loaded = append(loaded, url.String())
+		return []byte(`{"includes": ["child.json"]}`), nil
+	})}}
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	_, err := l.loadURLsRecursive(ctx, nil, url.URL{Scheme: "mem", Host: "config", Path: "/parent.json"})
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, gocontext.Canceled))
+	assert.Empty(t, loaded)
+}
+
+func TestLoadURL_HTTPDeadline(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	u, err := url.Parse(server.URL + "/slow.json")
+	assert.Nil(t, err)
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = loadURL(ctx, *u)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, gocontext.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func testConcurrentLoader(workers int, delay func(url.URL) time.Duration, files map[string]string) (*loader, *int32) {
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	handler := SchemeHandlerFunc(func(ctx gocontext.Context, u url.URL) ([]byte, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		select {
+		case <-time.After(delay(u)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		data, ok := files[u.Host+u.Path]
+		if !ok {
+			return nil, makeError("Not found : %v", u.String())
+		}
+		return []byte(data), nil
+	})
+	return &loader{newFiledata: newFiledata, handlers: map[string]SchemeHandler{"mem": handler}, workers: newWorkers(workers)}, &maxInFlight
+}
+
+func TestLoader_ConcurrentOrder(t *testing.T) {
+	files := map[string]string{"c/root.json": `{"includes": ["a.json", "b.json", "c.json", "d.json"]}`}
+	var expected []interface{}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		files["c/"+name+".json"] = `{"includes": ["` + name + `1.json", "` + name + `2.json"], "` + name + `": true}`
+		for j := 1; j <= 2; j++ {
+			files["c/"+name+fmt.Sprint(j)+".json"] = fmt.Sprintf(`{"%v%v": %v}`, name, j, i)
+			expected = append(expected, map[string]interface{}{fmt.Sprint(name, j): int64(i)})
+		}
+		expected = append(expected, map[string]interface{}{name: true})
+	}
+	expected = append(expected, map[string]interface{}{})
+	// later siblings load faster, so would be merged first if the order were not kept
+	delay := func(u url.URL) time.Duration {
+		if u.Path == "/root.json" {
+			return 0
+		}
+		return time.Duration('e'-u.Path[1]) * 5 * time.Millisecond
+	}
+	l, maxInFlight := testConcurrentLoader(2, delay, files)
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, url.URL{Scheme: "mem", Host: "c", Path: "/root.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data.objs())
+	assert.Equal(t, int32(2), *maxInFlight)
+}
+
+func TestLoader_ConcurrentRecursive(t *testing.T) {
+	l, _ := testConcurrentLoader(4, func(url.URL) time.Duration { return 0 }, map[string]string{
+		"c/root.json": `{"includes": ["a.json", "b.json"]}`,
+		"c/a.json":    `{"a": 1}`,
+		"c/b.json":    `{"includes": ["root.json"]}`,
+	})
+	_, err := l.loadURLsRecursive(gocontext.Background(), nil, url.URL{Scheme: "mem", Host: "c", Path: "/root.json"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The url recursively includes itself (mem://c/root.json)")
+}
+
+func TestLoader_ConcurrentError(t *testing.T) {
+	l, _ := testConcurrentLoader(4, func(u url.URL) time.Duration {
+		if u.Path == "/slow.json" {
+			return time.Second
+		}
+		return 0
+	}, map[string]string{"c/root.json": `{"includes": ["slow.json", "missing.json"]}`, "c/slow.json": `{}`})
+	start := time.Now()
+	_, err := l.loadURLsRecursive(gocontext.Background(), nil, url.URL{Scheme: "mem", Host: "c", Path: "/root.json"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Not found : mem://c/missing.json")
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func benchmarkLoadURLs(b *testing.B, concurrency int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Path == "/root.json" {
+			var includes []string
+			for i := 0; i < 20; i++ {
+				includes = append(includes, fmt.Sprintf(`"include%v.json"`, i))
+			}
+			fmt.Fprintf(w, `{"includes": [%v]}`, strings.Join(includes, ","))
+			return
+		}
+		fmt.Fprintf(w, `{"%v": true}`, strings.TrimSuffix(r.URL.Path[1:], ".json"))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL + "/root.json")
+	assert.Nil(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := New(WithConcurrency(concurrency))
+		err := c.AddURLs(*u)
+		assert.Nil(b, err)
+	}
+}
+
+func BenchmarkLoadURLs_Sequential(b *testing.B) {
+	benchmarkLoadURLs(b, 1)
+}
+
+func BenchmarkLoadURLs_Concurrent(b *testing.B) {
+	benchmarkLoadURLs(b, DefaultConcurrency)
+}
+
 // --------
 
 func TestLoadURLError(t *testing.T) {
-	data, err := loadURL(url.URL{})
+	data, err := loadURL(gocontext.Background(), url.URL{})
 	assert.NotNil(t, err)
 	assert.Nil(t, data)
 }
@@ -194,7 +378,7 @@ func TestLoadURL(t *testing.T) {
 	testWaitForURL(t, "http://0.0.0.0:9999")
 	url, err := url.Parse("http://0.0.0.0:9999/valid_parent.json")
 	assert.Nil(t, err)
-	data, err := loadURL(*url)
+	data, err := loadURL(gocontext.Background(), *url)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 	assert.Contains(t, string(data), "parent")
@@ -205,7 +389,7 @@ func TestLoadURL_Relative(t *testing.T) {
 	assert.Nil(t, err)
 	url, err := toURL(root, "./testdata/valid_parent.json")
 	assert.Nil(t, err)
-	data, err := loadURL(url)
+	data, err := loadURL(gocontext.Background(), url)
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
 	assert.Contains(t, string(data), "parent")
@@ -216,7 +400,7 @@ func TestLoadURL_Relative(t *testing.T) {
 var testLoader = loader{newFiledata: newFiledata}
 
 func TestLoadURLsRecursive_LoadError(t *testing.T) {
-	data, err := testLoader.loadURLsRecursive(nil, url.URL{})
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url.URL{})
 	assert.NotNil(t, err)
 	assert.Nil(t, data)
 }
@@ -228,7 +412,7 @@ func TestLoadURLsRecursive_IncludesError(t *testing.T) {
 	url, err := toURL(root, "loader.go")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "Could not unmarshal")
 	assert.Nil(t, data)
@@ -241,7 +425,7 @@ func TestLoadURLsRecursive_BadUrlInInclude(t *testing.T) {
 	url, err := toURL(root, "testdata/bad_url_in_include.json")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "Could not parse path")
 	assert.Nil(t, data)
@@ -254,7 +438,7 @@ func TestLoadURLsRecursive_MissingFileInInclude(t *testing.T) {
 	url, err := toURL(root, "testdata/missing_file_in_include.json")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "Failed to load url")
 	assert.Nil(t, data)
@@ -267,7 +451,7 @@ func TestLoadURLsRecursive_RecursiveInclude(t *testing.T) {
 	url, err := toURL(root, "testdata/recursive_include_parent.json")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "The url recursively includes itself")
 	assert.Nil(t, data)
@@ -280,7 +464,7 @@ func TestLoadURLsRecursive(t *testing.T) {
 	url, err := toURL(root, "testdata/valid_parent.json")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 	assert.Equal(t, 3, len(data))
@@ -296,7 +480,7 @@ func TestLoadURLsRecursive_BlankChildYaml(t *testing.T) {
 	url, err := toURL(root, "testdata/parent_blank.yaml")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
@@ -308,7 +492,7 @@ func TestLoadURLsRecursive_BlankChildJson(t *testing.T) {
 	url, err := toURL(root, "testdata/parent_blank.json")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
@@ -320,7 +504,7 @@ func TestLoadURLsRecursive_BlankChildToml(t *testing.T) {
 	url, err := toURL(root, "testdata/parent_blank.toml")
 	assert.Nil(t, err)
 	assert.NotNil(t, url)
-	data, err := testLoader.loadURLsRecursive(nil, url)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, url)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
@@ -0,0 +1,79 @@
+package conflate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pkgurl "net/url"
+	"strings"
+	"sync"
+)
+
+// Lock maps the urls of remote files, as returned by url.Redacted, to the hex encoded sha256 digests of their data, see WithLock.
+// Files loaded with the file and fs schemes are not locked.
+type Lock map[string]string
+
+// DigestError is the error returned when the sha256 digest of the data loaded from a url is not the expected digest
+type DigestError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("The sha256 digest of %v is %v, but %v was expected", e.URL, e.Actual, e.Expected)
+}
+
+// digests records the digests of the remote files that are loaded, and checks them against any lock
+type digests struct {
+	mutex  sync.Mutex
+	loaded Lock
+	lock   Lock
+}
+
+func newDigests() *digests {
+	return &digests{loaded: make(Lock)}
+}
+
+// verify checks the data loaded from the url against the digest of its include, and against the lock
+func (d *digests) verify(include includeURL, data []byte) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	key := include.url.Redacted()
+	if include.sha256 != "" && !strings.EqualFold(include.sha256, actual) {
+		return &DigestError{URL: key, Expected: strings.ToLower(include.sha256), Actual: actual}
+	}
+	if d == nil || !lockable(include.url) {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.lock != nil {
+		expected, ok := d.lock[key]
+		if !ok {
+			return makeError("The url is not in the lock : %v", key)
+		}
+		if !strings.EqualFold(expected, actual) {
+			return &DigestError{URL: key, Expected: strings.ToLower(expected), Actual: actual}
+		}
+	}
+	d.loaded[key] = actual
+	return nil
+}
+
+func (d *digests) copy() Lock {
+	lock := make(Lock)
+	if d == nil {
+		return lock
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for url, digest := range d.loaded {
+		lock[url] = digest
+	}
+	return lock
+}
+
+func lockable(url pkgurl.URL) bool {
+	return url.Scheme != "file" && url.Scheme != fsScheme
+}
@@ -0,0 +1,132 @@
+package conflate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDigest(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// testLockServer serves the files, which can be changed while holding the mutex
+func testLockServer(t *testing.T, files map[string]string, mutex *sync.Mutex) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		data, ok := files[r.URL.Path]
+		mutex.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testDigestError(t *testing.T, err error) *DigestError {
+	var digestErr *DigestError
+	assert.True(t, errors.As(err, &digestErr), "%v", err)
+	return digestErr
+}
+
+func TestIncludes_SHA256(t *testing.T) {
+	server := testLockServer(t, map[string]string{"/a.json": `{"a": 1}`}, &sync.Mutex{})
+	c := New()
+	err := c.AddData([]byte(`{"includes": [{"path": "` + server.URL + `/a.json", "sha256": "` + testDigest(`{"a": 1}`) + `"}]}`))
+	assert.Nil(t, err)
+
+	err = c.AddData([]byte(`{"includes": [{"path": "` + server.URL + `/a.json", "sha256": "` + testDigest("other") + `"}]}`))
+	digestErr := testDigestError(t, err)
+	assert.Equal(t, server.URL+"/a.json", digestErr.URL)
+	assert.Equal(t, testDigest("other"), digestErr.Expected)
+	assert.Equal(t, testDigest(`{"a": 1}`), digestErr.Actual)
+	assert.Equal(t, "The sha256 digest of "+server.URL+"/a.json is "+testDigest(`{"a": 1}`)+", but "+testDigest("other")+" was expected", err.Error())
+}
+
+func TestIncludes_SHA256Glob(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{"conf.d/a.json": `{"a": 1}`, "conf.d/b.json": `{"b": 1}`})
+	c := New()
+	err := c.AddData([]byte(`{"includes": [{"path": "` + filepath.Join(dir, "conf.d/a.*") + `", "sha256": "` + testDigest(`{"a": 1}`) + `"}]}`))
+	assert.Nil(t, err)
+
+	err = c.AddData([]byte(`{"includes": [{"path": "` + filepath.Join(dir, "conf.d") + `", "sha256": "` + testDigest(`{"a": 1}`) + `"}]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The sha256 of an include can only pin a single file, but file://")
+	assert.Contains(t, err.Error(), "conf.d matches 2 files")
+}
+
+func TestIncludes_SHA256BeforeUnmarshal(t *testing.T) {
+	server := testLockServer(t, map[string]string{"/a.json": `not json`}, &sync.Mutex{})
+	c := New()
+	err := c.AddData([]byte(`{"includes": [{"path": "` + server.URL + `/a.json", "sha256": "` + testDigest("other") + `"}]}`))
+	testDigestError(t, err)
+}
+
+func TestFiledata_IncludeSHA256Invalid(t *testing.T) {
+	_, err := testLoader.wrapFiledata([]byte(`{"includes":[{"path": "a", "sha256": "abc"}]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not valid against the schema")
+}
+
+func TestConflate_Lock(t *testing.T) {
+	files := map[string]string{
+		"/a.json": `{"includes": ["b.json"], "a": 1}`,
+		"/b.json": `{"b": 1}`,
+	}
+	var mutex sync.Mutex
+	server := testLockServer(t, files, &mutex)
+	c := New()
+	err := c.AddFiles("testdata/valid_child.json")
+	assert.Nil(t, err)
+	err = c.AddData([]byte(`{"includes": ["` + server.URL + `/a.json"]}`))
+	assert.Nil(t, err)
+	lock := c.Lock()
+	assert.Equal(t, Lock{
+		server.URL + "/a.json": testDigest(files["/a.json"]),
+		server.URL + "/b.json": testDigest(files["/b.json"]),
+	}, lock)
+
+	c = New(WithLock(lock))
+	err = c.AddFiles("testdata/valid_child.json")
+	assert.Nil(t, err)
+	err = c.AddData([]byte(`{"includes": ["` + server.URL + `/a.json"]}`))
+	assert.Nil(t, err)
+
+	mutex.Lock()
+	files["/b.json"] = `{"b": 2}`
+	mutex.Unlock()
+	c = New(WithLock(lock))
+	err = c.AddData([]byte(`{"includes": ["` + server.URL + `/a.json"]}`))
+	digestErr := testDigestError(t, err)
+	assert.Equal(t, server.URL+"/b.json", digestErr.URL)
+	assert.Equal(t, testDigest(`{"b": 1}`), digestErr.Expected)
+	assert.Equal(t, testDigest(`{"b": 2}`), digestErr.Actual)
+}
+
+func TestConflate_LockMissingURL(t *testing.T) {
+	server := testLockServer(t, map[string]string{"/a.json": `{"a": 1}`}, &sync.Mutex{})
+	c := New(WithLock(Lock{}))
+	err := c.AddData([]byte(`{"includes": ["` + server.URL + `/a.json"]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The url is not in the lock : "+server.URL+"/a.json")
+}
+
+func TestWithLock_Patch(t *testing.T) {
+	server := testLockServer(t, map[string]string{"/p.merge-patch.json": `{"a": 2}`}, &sync.Mutex{})
+	c := New(WithLock(Lock{server.URL + "/p.merge-patch.json": testDigest(`{"a": 1}`)}))
+	err := c.ApplyPatchFiles(server.URL + "/p.merge-patch.json")
+	digestErr := testDigestError(t, err)
+	assert.Equal(t, server.URL+"/p.merge-patch.json", digestErr.URL)
+	assert.Nil(t, c.data)
+}
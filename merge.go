@@ -5,9 +5,55 @@ import (
 	"reflect"
 )
 
+// ArrayMerge defines how the items of a source array are merged into a destination array
+type ArrayMerge string
+
+const (
+	// ArrayAppend adds the source items after the destination items
+	ArrayAppend ArrayMerge = "append"
+	// ArrayPrepend adds the source items before the destination items
+	ArrayPrepend ArrayMerge = "prepend"
+	// ArrayReplace replaces the destination items with the source items
+	ArrayReplace ArrayMerge = "replace"
+	// ArrayUnion adds the source items after the destination items, dropping any duplicate items
+	ArrayUnion ArrayMerge = "union"
+)
+
+type pathArrayMerge struct {
+	pattern  string
+	strategy ArrayMerge
+}
+
+type pathArrayMergeKey struct {
+	pattern string
+	key     string
+}
+
+type merger struct {
+	arrayMerge         ArrayMerge
+	pathArrayMerges    []pathArrayMerge
+	pathArrayMergeKeys []pathArrayMergeKey
+	provenance         provenance
+	source             *sourceMap
+	owners             map[context]*sourceMap
+	strict             StrictMode
+	conflicts          *[]Conflict
+	coercion           Coercion
+	coercionSchema     *Schema
+	mergeFuncs         []pathMergeFunc
+}
+
 func mergeTo(toData interface{}, fromData ...interface{}) error {
+	return (&merger{}).mergeTo(toData, fromData...)
+}
+
+func merge(pToData interface{}, fromData interface{}) error {
+	return (&merger{}).merge(pToData, fromData)
+}
+
+func (m *merger) mergeTo(toData interface{}, fromData ...interface{}) error {
 	for _, fromDatum := range fromData {
-		err := merge(toData, fromDatum)
+		err := m.merge(toData, fromDatum)
 		if err != nil {
 			return err
 		}
@@ -15,11 +61,32 @@ func mergeTo(toData interface{}, fromData ...interface{}) error {
 	return nil
 }
 
-func merge(pToData interface{}, fromData interface{}) error {
-	return mergeRecursive(rootContext(), pToData, fromData)
+func (m *merger) merge(pToData interface{}, fromData interface{}) error {
+	return m.mergeRecursive(rootContext(), pToData, fromData)
+}
+
+func (m *merger) arrayMergeAt(ctx context) ArrayMerge {
+	for _, pm := range m.pathArrayMerges {
+		if ctx.match(pm.pattern) {
+			return pm.strategy
+		}
+	}
+	if m.arrayMerge == "" {
+		return ArrayAppend
+	}
+	return m.arrayMerge
+}
+
+func (m *merger) arrayMergeKeyAt(ctx context) string {
+	for _, pk := range m.pathArrayMergeKeys {
+		if ctx.match(pk.pattern) {
+			return pk.key
+		}
+	}
+	return ""
 }
 
-func mergeRecursive(ctx context, pToData interface{}, fromData interface{}) error {
+func (m *merger) mergeRecursive(ctx context, pToData interface{}, fromData interface{}) error {
 	if pToData == nil {
 		return makeContextError(ctx, "The destination variable must not be nil")
 	}
@@ -28,32 +95,47 @@ func mergeRecursive(ctx context, pToData interface{}, fromData interface{}) erro
 		return makeContextError(ctx, "The destination variable must be a pointer")
 	}
 
+	toVal := pToVal.Elem()
+	d, err := parseDirective(ctx, fromData)
+	if err != nil {
+		return err
+	}
+	if d != nil {
+		return m.mergeDirective(ctx, pToData, toVal, d)
+	}
+
 	if fromData == nil {
 		return nil
 	}
 
-	toVal := pToVal.Elem()
 	fromVal := reflect.ValueOf(fromData)
 
 	toData := toVal.Interface()
-	if toVal.Interface() == nil {
-		toVal.Set(fromVal)
-		return nil
+	if toData == nil {
+		return m.replace(ctx, toVal, fromData)
+	}
+
+	if fn := m.mergeFuncAt(ctx, fromVal.Kind()); fn != nil {
+		return m.mergeFunc(ctx, toVal, toData, fromData, fn)
 	}
 
-	var err error
+	err = m.checkConflict(ctx, toData, fromData)
+	if err != nil {
+		return err
+	}
+	m.recordAt(ctx)
 	switch fromVal.Kind() {
 	case reflect.Map:
-		err = mergeMapRecursive(ctx, toVal, fromVal, toData, fromData)
+		err = m.mergeMapRecursive(ctx, toVal, fromVal, toData, fromData)
 	case reflect.Slice:
-		err = mergeSliceRecursive(ctx, toVal, fromVal, toData, fromData)
+		err = m.mergeSliceRecursive(ctx, toVal, fromVal, toData, fromData)
 	default:
-		err = mergeDefaultRecursive(ctx, toVal, fromVal, toData, fromData)
+		err = m.mergeDefaultRecursive(ctx, toVal, fromVal, toData, fromData)
 	}
 	return err
 }
 
-func mergeMapRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
+func (m *merger) mergeMapRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
 	toData interface{}, fromData interface{}) error {
 
 	fromProps, ok := fromData.(map[string]interface{})
@@ -64,17 +146,25 @@ func mergeMapRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
 	if toProps == nil {
 		return makeContextError(ctx, "The destination value must be a map[string]interface{}")
 	}
+	// the destination map may be shared, so the merged properties are set on a copy
+	props := make(map[string]interface{}, len(toProps)+len(fromProps))
+	for name, toProp := range toProps {
+		props[name] = toProp
+	}
 	for name, fromProp := range fromProps {
-		if val := toProps[name]; val == nil {
-			toProps[name] = fromProp
-		} else {
-			err := merge(&val, fromProp)
-			if err != nil {
-				return makeContextError(ctx.add(name), "Failed to merge object property : %v : %v", name, err)
-			}
-			toProps[name] = val
+		if isDelete(fromProp) {
+			m.recordAt(ctx.add(name))
+			delete(props, name)
+			continue
+		}
+		val := props[name]
+		err := m.mergeRecursive(ctx.add(name), &val, fromProp)
+		if err != nil {
+			return makeContextError(ctx.add(name), "Failed to merge object property : %v : %v", name, err)
 		}
+		props[name] = val
 	}
+	toVal.Set(reflect.ValueOf(props))
 	return nil
 }
 
@@ -88,7 +178,7 @@ func toSliceOfInterface[S interface{}](source []S) []interface{} {
 	return out
 }
 
-func mergeSliceRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
+func (m *merger) mergeSliceRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
 	toData interface{}, fromData interface{}) error {
 
 	var fromItems, toItems []interface{}
@@ -111,12 +201,103 @@ func mergeSliceRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value
 		return makeContextError(ctx, fmt.Sprintf("The destination value must be a []interface{}, but was %s", toVal.Type()))
 	}
 
-	toItems = append(toItems, fromItems...)
+	if key := m.arrayMergeKeyAt(ctx); key != "" {
+		return m.mergeKeyedSlice(ctx, toVal, key, toItems, fromItems)
+	}
+
+	resolved, _, err := resolve(ctx, fromItems)
+	if err != nil {
+		return err
+	}
+	fromItems = resolved.([]interface{})
+
+	switch strategy := m.arrayMergeAt(ctx); strategy {
+
+	case ArrayAppend:
+		toItems = append(append([]interface{}{}, toItems...), fromItems...)
+	case ArrayPrepend:
+		toItems = append(append([]interface{}{}, fromItems...), toItems...)
+	case ArrayReplace:
+		toItems = fromItems
+	case ArrayUnion:
+		toItems = unionItems(toItems, fromItems)
+	default:
+		return makeContextError(ctx, "Unknown array merge strategy (%v)", strategy)
+	}
 	toVal.Set(reflect.ValueOf(toItems))
 	return nil
 }
 
-func mergeDefaultRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
+func (m *merger) mergeKeyedSlice(ctx context, toVal reflect.Value, key string, toItems []interface{}, fromItems []interface{}) error {
+	items := append([]interface{}{}, toItems...)
+	for _, fromItem := range fromItems {
+		i := indexOfKey(items, key, fromItem)
+		if i < 0 {
+			if isDelete(fromItem) {
+				continue
+			}
+			var item interface{}
+			err := m.mergeRecursive(ctx.addInt(len(items)), &item, fromItem)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			continue
+		}
+		if isDelete(fromItem) {
+			items = append(items[:i], items[i+1:]...)
+			continue
+		}
+		item := items[i]
+		err := m.mergeRecursive(ctx.addInt(i), &item, fromItem)
+		if err != nil {
+			return makeContextError(ctx.addInt(i), "Failed to merge array item : %v : %v", i, err)
+		}
+		items[i] = item
+	}
+	toVal.Set(reflect.ValueOf(items))
+	return nil
+}
+
+func indexOfKey(items []interface{}, key string, searchItem interface{}) int {
+	searchProps, ok := searchItem.(map[string]interface{})
+	if !ok {
+		return -1
+	}
+	if d, _ := parseDirective(rootContext(), searchProps); d != nil {
+		searchProps, _ = d.value.(map[string]interface{})
+	}
+	if searchProps[key] == nil {
+		return -1
+	}
+	for i, item := range items {
+		if props, ok := item.(map[string]interface{}); ok && reflect.DeepEqual(props[key], searchProps[key]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func unionItems(toItems []interface{}, fromItems []interface{}) []interface{} {
+	var items []interface{}
+	for _, item := range append(append([]interface{}{}, toItems...), fromItems...) {
+		if !containsItem(items, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsItem(items []interface{}, searchItem interface{}) bool {
+	for _, item := range items {
+		if reflect.DeepEqual(item, searchItem) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *merger) mergeDefaultRecursive(ctx context, toVal reflect.Value, fromVal reflect.Value,
 	toData interface{}, fromData interface{}) error {
 
 	if reflect.DeepEqual(toData, fromData) {
@@ -128,8 +309,39 @@ func mergeDefaultRecursive(ctx context, toVal reflect.Value, fromVal reflect.Val
 		toType = toVal.Elem().Type()
 	}
 	if !fromType.AssignableTo(toType) {
-		return makeContextError(ctx, "The destination type (%v) must be the same as the source type (%v)", toType, fromType)
+		coerced, ok, err := m.coerce(ctx, toData, fromData)
+		if err != nil {
+			return err
+		}
+		if !ok || !reflect.TypeOf(coerced).AssignableTo(toVal.Type()) {
+			return makeContextError(ctx, "The destination type (%v) must be the same as the source type (%v)", toType, fromType)
+		}
+		fromVal = reflect.ValueOf(coerced)
 	}
 	toVal.Set(fromVal)
 	return nil
 }
+
+func copyValue(data interface{}) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(data))
+		for name, prop := range data {
+			out[name] = copyValue(prop)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(data))
+		for i, item := range data {
+			out[i] = copyValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(data))
+		for i, item := range data {
+			out[i] = copyValue(item).(map[string]interface{})
+		}
+		return out
+	}
+	return data
+}
@@ -0,0 +1,88 @@
+package conflate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MergeConflict describes a value changed differently by ours and theirs in a three-way merge.
+// Values that are missing from a revision are nil.
+type MergeConflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+func (c MergeConflict) String() string {
+	return fmt.Sprintf("The value is changed by both ours (%v) and theirs (%v) (%v)", c.Ours, c.Theirs, c.Path)
+}
+
+// absent marks a property missing from a revision, so that removing a value is distinguished from setting it to null
+type absent struct{}
+
+// Merge3 merges the changes made to the base data by ours and theirs. Objects are merged property by property,
+// while other values, including arrays, are merged as a whole. Where both change the same value differently,
+// ours is kept and the conflict is reported.
+func Merge3(base, ours, theirs *Conflate) (*Conflate, []MergeConflict) {
+	var conflicts []MergeConflict
+	c := New()
+	data := merge3(rootContext(), base.data, ours.data, theirs.data, &conflicts)
+	if _, ok := data.(absent); !ok {
+		c.data = copyValue(data)
+	}
+	return c, conflicts
+}
+
+func merge3(ctx context, base, ours, theirs interface{}, conflicts *[]MergeConflict) interface{} {
+	switch {
+	case equalValues(ours, theirs), equalValues(base, theirs):
+		return ours
+	case equalValues(base, ours):
+		return theirs
+	}
+	ourProps, ok1 := ours.(map[string]interface{})
+	theirProps, ok2 := theirs.(map[string]interface{})
+	if !ok1 || !ok2 {
+		*conflicts = append(*conflicts, MergeConflict{Path: ctx.String(), Base: present(base), Ours: present(ours), Theirs: present(theirs)})
+		return ours
+	}
+	baseProps, _ := base.(map[string]interface{})
+	props := make(map[string]interface{})
+	for _, name := range sortedNames(baseProps, ourProps, theirProps) {
+		val := merge3(ctx.add(name), propOf(baseProps, name), propOf(ourProps, name), propOf(theirProps, name), conflicts)
+		if _, ok := val.(absent); !ok {
+			props[name] = val
+		}
+	}
+	return props
+}
+
+func sortedNames(props ...map[string]interface{}) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range props {
+		for name := range p {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func propOf(props map[string]interface{}, name string) interface{} {
+	if prop, ok := props[name]; ok {
+		return prop
+	}
+	return absent{}
+}
+
+func present(data interface{}) interface{} {
+	if _, ok := data.(absent); ok {
+		return nil
+	}
+	return copyValue(data)
+}
@@ -0,0 +1,75 @@
+package conflate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMerge3(t *testing.T, base, ours, theirs string) (interface{}, []MergeConflict) {
+	var cs []*Conflate
+	for _, data := range []string{base, ours, theirs} {
+		c, err := FromData([]byte(data))
+		assert.Nil(t, err)
+		cs = append(cs, c)
+	}
+	c, conflicts := Merge3(cs[0], cs[1], cs[2])
+	return c.data, conflicts
+}
+
+func TestMerge3(t *testing.T) {
+	data, conflicts := testMerge3(t,
+		`{"a": 1, "b": 1, "c": 1, "d": 1, "e": {"x": 1}, "list": [1]}`,
+		`{"a": 2, "b": 1, "c": 2, "e": {"x": 1, "y": 1}, "list": [1], "f": 1}`,
+		`{"a": 1, "b": 3, "c": 2, "d": 1, "e": {"x": 2}, "list": [1, 2], "g": null}`)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, map[string]interface{}{
+		"a": int64(2), "b": int64(3), "c": int64(2), "e": map[string]interface{}{"x": int64(2), "y": int64(1)},
+		"list": []interface{}{int64(1), int64(2)}, "f": int64(1), "g": nil,
+	}, data)
+}
+
+func TestMerge3_Conflicts(t *testing.T) {
+	data, conflicts := testMerge3(t,
+		`{"a": 1, "b": 1, "c": {"x": 1}, "list": [1]}`,
+		`{"a": 2, "c": {"x": 2}, "list": [2], "d": 1}`,
+		`{"a": 3, "b": 2, "c": {"x": 3}, "list": [3], "d": 2}`)
+	assert.Equal(t, map[string]interface{}{
+		"a": int64(2), "c": map[string]interface{}{"x": int64(2)}, "list": []interface{}{int64(2)}, "d": int64(1),
+	}, data)
+	assert.Equal(t, []MergeConflict{
+		{Path: "#/a", Base: int64(1), Ours: int64(2), Theirs: int64(3)},
+		{Path: "#/b", Base: int64(1), Ours: nil, Theirs: int64(2)},
+		{Path: "#/c/x", Base: int64(1), Ours: int64(2), Theirs: int64(3)},
+		{Path: "#/d", Base: nil, Ours: int64(1), Theirs: int64(2)},
+		{Path: "#/list", Base: []interface{}{int64(1)}, Ours: []interface{}{int64(2)}, Theirs: []interface{}{int64(3)}},
+	}, conflicts)
+	assert.Equal(t, "The value is changed by both ours (2) and theirs (3) (#/a)", conflicts[0].String())
+}
+
+func TestMerge3_InputsUnchanged(t *testing.T) {
+	base, _ := FromData([]byte(`{"a": {"x": 1}}`))
+	ours, _ := FromData([]byte(`{"a": {"x": 1}, "b": {"y": 1}}`))
+	theirs, _ := FromData([]byte(`{"a": {"x": 2}}`))
+	c, _ := Merge3(base, ours, theirs)
+	c.data.(map[string]interface{})["b"].(map[string]interface{})["y"] = "changed"
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"x": int64(1)}, "b": map[string]interface{}{"y": int64(1)}}, ours.data)
+}
+
+func TestMerge3_MixedFormats(t *testing.T) {
+	dir := testGlobDir(t, map[string]string{
+		"base.yaml":   "port: 8080\nhosts: [a]\n",
+		"ours.json":   `{"port": 8080, "hosts": ["a"]}`,
+		"theirs.yaml": "port: 9090\nhosts: [a, b]\n",
+	})
+	var cs []*Conflate
+	for _, name := range []string{"base.yaml", "ours.json", "theirs.yaml"} {
+		c, err := FromFiles(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		cs = append(cs, c)
+	}
+	c, conflicts := Merge3(cs[0], cs[1], cs[2])
+	assert.Empty(t, conflicts)
+	assert.Equal(t, map[string]interface{}{"port": float64(9090), "hosts": []interface{}{"a", "b"}}, c.data)
+}
@@ -84,6 +84,88 @@ func TestMerge_SimpleSlice(t *testing.T) {
 	assert.Equal(t, toData, []interface{}{1, 2, 3, 4, 5, 6})
 }
 
+func TestMerge_SliceStrategies(t *testing.T) {
+	tests := map[ArrayMerge][]interface{}{
+		ArrayAppend:  {1, 2, 3, 3, 4},
+		ArrayPrepend: {3, 4, 1, 2, 3},
+		ArrayReplace: {3, 4},
+		ArrayUnion:   {1, 2, 3, 4},
+	}
+	for strategy, expected := range tests {
+		m := merger{arrayMerge: strategy}
+		toData := []interface{}{1, 2, 3}
+		err := m.merge(&toData, []interface{}{3, 4})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, toData, strategy)
+	}
+}
+
+func TestMerge_SliceUnknownStrategy(t *testing.T) {
+	m := merger{arrayMerge: "bad"}
+	toData := []interface{}{1}
+	err := m.merge(&toData, []interface{}{2})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown array merge strategy (bad)")
+}
+
+func TestMerge_SlicePathStrategy(t *testing.T) {
+	m := merger{pathArrayMerges: []pathArrayMerge{
+		{pattern: "#/hosts", strategy: ArrayReplace},
+		{pattern: "#/*/ports", strategy: ArrayUnion},
+	}}
+	toData := map[string]interface{}{
+		"hosts": []interface{}{"a", "b"},
+		"other": []interface{}{"a", "b"},
+		"svc":   map[string]interface{}{"ports": []interface{}{80, 443}},
+	}
+	fromData := map[string]interface{}{
+		"hosts": []interface{}{"c"},
+		"other": []interface{}{"c"},
+		"svc":   map[string]interface{}{"ports": []interface{}{443, 8080}},
+	}
+	err := m.merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"c"}, toData["hosts"])
+	assert.Equal(t, []interface{}{"a", "b", "c"}, toData["other"])
+	assert.Equal(t, []interface{}{80, 443, 8080}, toData["svc"].(map[string]interface{})["ports"])
+}
+
+func TestMerge_SliceKeyed(t *testing.T) {
+	m := merger{pathArrayMergeKeys: []pathArrayMergeKey{{pattern: "#/services", key: "name"}}}
+	toData := map[string]interface{}{
+		"services": []interface{}{
+			map[string]interface{}{"name": "api", "port": 80, "tags": []interface{}{"a"}},
+			map[string]interface{}{"name": "worker", "port": 81},
+		},
+	}
+	fromData := map[string]interface{}{
+		"services": []interface{}{
+			map[string]interface{}{"name": "worker", "port": 90},
+			map[string]interface{}{"name": "cron"},
+			map[string]interface{}{"port": 91},
+			map[string]interface{}{"name": "api", "tags": []interface{}{"b"}},
+		},
+	}
+	err := m.merge(&toData, fromData)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "api", "port": 80, "tags": []interface{}{"a", "b"}},
+		map[string]interface{}{"name": "worker", "port": 90},
+		map[string]interface{}{"name": "cron"},
+		map[string]interface{}{"port": 91},
+	}, toData["services"])
+}
+
+func TestMerge_SliceKeyedError(t *testing.T) {
+	m := merger{pathArrayMergeKeys: []pathArrayMergeKey{{pattern: "#", key: "name"}}}
+	toData := []interface{}{map[string]interface{}{"name": "api", "port": 80}}
+	fromData := []interface{}{map[string]interface{}{"name": "api", "port": "eighty"}}
+	err := m.merge(&toData, fromData)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Failed to merge array item : 0")
+	assert.Contains(t, err.Error(), "#[0]/port")
+}
+
 func TestMerge_ToNil(t *testing.T) {
 	fromData := make(map[string]interface{})
 	err := merge(nil, fromData)
@@ -370,3 +452,34 @@ var testMergeData2 = []byte(`
   ]
 }
 `)
+
+func TestMerge_InputsUnchanged(t *testing.T) {
+	newTo := func() map[string]interface{} {
+		return map[string]interface{}{"a": map[string]interface{}{"b": int64(1)}, "list": make([]interface{}, 1, 10)}
+	}
+	newFrom := func() map[string]interface{} {
+		return map[string]interface{}{"a": map[string]interface{}{"c": int64(2)}, "list": []interface{}{map[string]interface{}{"d": int64(3)}}, "new": map[string]interface{}{"e": int64(4)}}
+	}
+	to, from := newTo(), newFrom()
+	var data interface{} = to
+	for i := 0; i < 3; i++ {
+		err := mergeTo(&data, from)
+		assert.Nil(t, err)
+	}
+	data.(map[string]interface{})["a"].(map[string]interface{})["x"] = "changed"
+	data.(map[string]interface{})["new"].(map[string]interface{})["x"] = "changed"
+	data.(map[string]interface{})["list"].([]interface{})[1].(map[string]interface{})["x"] = "changed"
+	assert.Equal(t, newTo(), to)
+	assert.Equal(t, newFrom(), from)
+	// appending must not write to the spare capacity of the destination array
+	assert.Nil(t, to["list"].([]interface{})[:2][1])
+}
+
+func TestMerge_DeleteInputUnchanged(t *testing.T) {
+	to := map[string]interface{}{"a": int64(1), "b": int64(2)}
+	var data interface{} = to
+	err := mergeTo(&data, map[string]interface{}{"a": map[string]interface{}{DeleteDirective: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"b": int64(2)}, data)
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": int64(2)}, to)
+}
@@ -0,0 +1,35 @@
+package conflate
+
+import (
+	"reflect"
+)
+
+// MergeFunc merges the source value into the destination value at the given path, e.g. "#/quotas/cpu", returning the merged value
+type MergeFunc func(path string, toData interface{}, fromData interface{}) (interface{}, error)
+
+type pathMergeFunc struct {
+	pattern string
+	kind    reflect.Kind
+	fn      MergeFunc
+}
+
+func (m *merger) mergeFuncAt(ctx context, kind reflect.Kind) MergeFunc {
+	for _, pf := range m.mergeFuncs {
+		if (pf.pattern == "" || ctx.match(pf.pattern)) && (pf.kind == reflect.Invalid || pf.kind == kind) {
+			return pf.fn
+		}
+	}
+	return nil
+}
+
+func (m *merger) mergeFunc(ctx context, toVal reflect.Value, toData interface{}, fromData interface{}, fn MergeFunc) error {
+	fromData, _, err := resolve(ctx, fromData)
+	if err != nil {
+		return err
+	}
+	data, err := fn(ctx.String(), copyValue(toData), fromData)
+	if err != nil {
+		return makeContextError(ctx, "The merge function failed : %v", err)
+	}
+	return m.replace(ctx, toVal, data)
+}
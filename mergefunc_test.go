@@ -0,0 +1,64 @@
+package conflate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMergeSum(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+	return toData.(int64) + fromData.(int64), nil
+}
+
+func testMergeJoin(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+	return toData.(string) + "," + fromData.(string), nil
+}
+
+func TestMergeFunc_PathAndKind(t *testing.T) {
+	m := &merger{mergeFuncs: []pathMergeFunc{
+		{pattern: "#/quotas/*", kind: reflect.Int64, fn: testMergeSum},
+		{kind: reflect.String, fn: testMergeJoin},
+	}}
+	var data interface{} = map[string]interface{}{"quotas": map[string]interface{}{"cpu": int64(1), "name": "a"}, "other": int64(1), "tags": "x"}
+	err := m.mergeTo(&data,
+		map[string]interface{}{"quotas": map[string]interface{}{"cpu": int64(2), "name": "b"}, "other": int64(2), "tags": "y"},
+		map[string]interface{}{"quotas": map[string]interface{}{"cpu": int64(3), "mem": int64(4)}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"quotas": map[string]interface{}{"cpu": int64(6), "name": "a,b", "mem": int64(4)}, "other": int64(2), "tags": "x,y"}, data)
+}
+
+func TestMergeFunc_ArrayItems(t *testing.T) {
+	m := &merger{mergeFuncs: []pathMergeFunc{{pattern: "#/list", fn: func(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+		assert.Equal(t, "#/list", path)
+		return fromData, nil
+	}}}}
+	var data interface{} = map[string]interface{}{"list": []interface{}{int64(1)}}
+	err := m.mergeTo(&data, map[string]interface{}{"list": []interface{}{int64(2), map[string]interface{}{ReplaceDirective: int64(3)}}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"list": []interface{}{int64(2), int64(3)}}, data)
+}
+
+func TestMergeFunc_Error(t *testing.T) {
+	m := &merger{mergeFuncs: []pathMergeFunc{{fn: func(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+		return nil, errors.New("my error")
+	}}}}
+	var data interface{} = map[string]interface{}{"a": int64(1)}
+	err := m.mergeTo(&data, map[string]interface{}{"a": int64(2)})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "The merge function failed : my error")
+}
+
+func TestMergeFunc_DestinationUnchanged(t *testing.T) {
+	to := map[string]interface{}{"a": map[string]interface{}{"b": int64(1)}}
+	m := &merger{mergeFuncs: []pathMergeFunc{{pattern: "#/a", fn: func(path string, toData interface{}, fromData interface{}) (interface{}, error) {
+		toData.(map[string]interface{})["b"] = int64(2)
+		return toData, nil
+	}}}}
+	var data interface{} = to
+	err := m.mergeTo(&data, map[string]interface{}{"a": map[string]interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": int64(2)}}, data)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": int64(1)}}, to)
+}
@@ -0,0 +1,167 @@
+package conflate
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"reflect"
+)
+
+// Option configures a Conflate instance when passed to New
+type Option func(*Conflate)
+
+// WithArrayMerge sets the strategy used to merge arrays, which is ArrayAppend by default
+func WithArrayMerge(strategy ArrayMerge) Option {
+	return func(c *Conflate) {
+		c.merger.arrayMerge = strategy
+	}
+}
+
+// WithPathArrayMerge sets the strategy used to merge the arrays at paths matching the given pattern, e.g. "#/allowed_hosts" or "#/services/*/ports".
+// Array indices are ignored when matching, and the first matching pattern takes precedence over any global strategy.
+func WithPathArrayMerge(pattern string, strategy ArrayMerge) Option {
+	return func(c *Conflate) {
+		c.merger.pathArrayMerges = append(c.merger.pathArrayMerges, pathArrayMerge{pattern: pattern, strategy: strategy})
+	}
+}
+
+// WithArrayMergeKey merges the arrays at paths matching the given pattern by identity, e.g. WithArrayMergeKey("#/services", "name").
+// Source objects are deep merged into the destination object having the same value for the key field, and are otherwise appended.
+func WithArrayMergeKey(pattern string, key string) Option {
+	return func(c *Conflate) {
+		c.merger.pathArrayMergeKeys = append(c.merger.pathArrayMergeKeys, pathArrayMergeKey{pattern: pattern, key: key})
+	}
+}
+
+// WithStrict sets how a scalar value, or the type of a value, being overridden by a different source is reported. It is StrictOff by default.
+// Values changed by merge directives are not reported.
+func WithStrict(mode StrictMode) Option {
+	return func(c *Conflate) {
+		c.merger.strict = mode
+	}
+}
+
+// WithCoercion sets how a source value is converted when its type differs from the type of the destination value. It is CoerceStrict by default.
+func WithCoercion(coercion Coercion) Option {
+	return func(c *Conflate) {
+		c.merger.coercion = coercion
+	}
+}
+
+// WithCoercionSchema sets the schema that defines the types used by CoerceSchema
+func WithCoercionSchema(s *Schema) Option {
+	return func(c *Conflate) {
+		c.merger.coercionSchema = s
+	}
+}
+
+// WithMergeFunc merges the values at paths matching the given pattern, and of the given source kind, using the given function
+// instead of the built-in merge, e.g. WithMergeFunc("#/quotas/*", reflect.Int64, sum).
+// A blank pattern matches any path, reflect.Invalid matches any kind, and the first matching function is used.
+// The function is not called when there is no destination value.
+func WithMergeFunc(pattern string, kind reflect.Kind, fn MergeFunc) Option {
+	return func(c *Conflate) {
+		c.merger.mergeFuncs = append(c.merger.mergeFuncs, pathMergeFunc{pattern: pattern, kind: kind, fn: fn})
+	}
+}
+
+// WithFSFallthrough loads the files missing from the file systems passed to AddFS from the given directory
+func WithFSFallthrough(dir string) Option {
+	return func(c *Conflate) {
+		c.fsDir = dir
+	}
+}
+
+// WithConcurrency sets the number of urls fetched at once, where sibling includes are fetched in parallel but still merged in order.
+// A value of 1 or less fetches the urls one at a time.
+func WithConcurrency(n int) Option {
+	return func(c *Conflate) {
+		c.loader.workers = newWorkers(n)
+	}
+}
+
+// WithHTTPCache caches the data loaded from http and https urls in the given directory. Cached data is revalidated
+// using its ETag or Last-Modified header unless fresh according to its Cache-Control header, and is also used when
+// the host cannot be reached or has a server error.
+func WithHTTPCache(dir string) Option {
+	return func(c *Conflate) {
+		c.httpLoader().cache = &httpCache{dir: dir}
+	}
+}
+
+// WithOffline loads http and https urls only from the cache set by WithHTTPCache, failing for urls that are not cached
+func WithOffline(offline bool) Option {
+	return func(c *Conflate) {
+		c.httpLoader().offline = offline
+	}
+}
+
+// WithHostAuth sends the credentials when loading http and https urls from the host, which is a host name, e.g. "config.example.com",
+// or a host name and port. A host name and port takes precedence over the host name alone.
+func WithHostAuth(host string, auth HostAuth) Option {
+	return func(c *Conflate) {
+		l := c.httpLoader()
+		transport, ok := l.client.Transport.(*authTransport)
+		if !ok {
+			transport = &authTransport{auths: make(map[string]HostAuth), transports: make(map[string]http.RoundTripper)}
+			l.client = &http.Client{Transport: transport}
+		}
+		transport.auths[host] = auth
+	}
+}
+
+// WithIncludePolicy restricts the schemes, hosts and files that can be included, and that http and https urls can be redirected to.
+// Includes that are not allowed fail with an IncludePolicyError.
+func WithIncludePolicy(policy IncludePolicy) Option {
+	return func(c *Conflate) {
+		c.loader.policy = &policy
+		c.httpLoader().policy = &policy
+	}
+}
+
+// WithGlobMatchRequired fails an include, or a file passed to AddFiles, that is a glob pattern, e.g. "conf.d/*.yaml", or a directory
+// that matches no files. Otherwise it is ignored. A pattern without a * wildcard, e.g. "app[1].json", that matches no files is
+// always reported as a missing file.
+func WithGlobMatchRequired(required bool) Option {
+	return func(c *Conflate) {
+		c.loader.globRequired = required
+	}
+}
+
+// WithLock fails when the data loaded from a remote url does not match its digest in the lock, or the url is not in the lock,
+// with a DigestError for a digest that does not match. See Conflate.Lock to create the lock.
+func WithLock(lock Lock) Option {
+	return func(c *Conflate) {
+		c.loader.digests.lock = lock
+	}
+}
+
+// WithTrustedKeys requires each file that is loaded, including includes, to have a detached ed25519 signature from one of the keys,
+// loaded from the url of the file with the SignatureSuffix added. A file without a valid signature fails with a SignatureError.
+func WithTrustedKeys(keys ...ed25519.PublicKey) Option {
+	return func(c *Conflate) {
+		c.loader.trustedKeys = append(c.loader.trustedKeys, keys...)
+	}
+}
+
+// WithDedupe merges the data loaded from a url only once, when it is included more than once by the files passed to a single call,
+// such as AddFiles, and loads it and its includes only once, counting them once towards WithMaxFiles. Data merged under different
+// mount points is not deduplicated.
+func WithDedupe(dedupe Dedupe) Option {
+	return func(c *Conflate) {
+		c.loader.dedupe = dedupe
+	}
+}
+
+// WithMaxIncludeDepth fails when files are included more than the given number of levels below the files, or data, that are added
+func WithMaxIncludeDepth(depth int) Option {
+	return func(c *Conflate) {
+		c.loader.maxDepth = depth
+	}
+}
+
+// WithMaxFiles fails when more than the given number of files, including includes, are loaded by a single call, such as AddFiles
+func WithMaxFiles(files int) Option {
+	return func(c *Conflate) {
+		c.loader.maxFiles = files
+	}
+}
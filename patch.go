@@ -0,0 +1,279 @@
+package conflate
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+type patchKind int
+
+const (
+	noPatch patchKind = iota
+	mergePatchKind
+	jsonPatchKind
+)
+
+// mergePatch applies an RFC 7386 JSON Merge Patch to the target, returning the patched target
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchProps, ok := patch.(map[string]interface{})
+	if !ok {
+		return copyValue(patch)
+	}
+	targetProps := make(map[string]interface{})
+	if props, ok := target.(map[string]interface{}); ok {
+		for name, prop := range props {
+			targetProps[name] = prop
+		}
+	}
+	for name, patchProp := range patchProps {
+		if patchProp == nil {
+			delete(targetProps, name)
+		} else {
+			targetProps[name] = mergePatch(targetProps[name], patchProp)
+		}
+	}
+	return targetProps
+}
+
+// jsonPatch applies the operations of an RFC 6902 JSON Patch to a copy of the target, returning the patched copy
+func jsonPatch(target interface{}, ops []interface{}) (interface{}, error) {
+	doc := copyValue(target)
+	for i, op := range ops {
+		var err error
+		doc, err = jsonPatchOp(doc, op)
+		if err != nil {
+			return nil, wrapError(err, "Failed to apply json patch operation %v", i)
+		}
+	}
+	return doc, nil
+}
+
+func jsonPatchOp(doc interface{}, rawOp interface{}) (interface{}, error) {
+	op, ok := rawOp.(map[string]interface{})
+	if !ok {
+		return nil, makeError("The operation must be an object")
+	}
+	name, _ := op["op"].(string)
+	path, err := pointerField(op, "path")
+	if err != nil {
+		return nil, err
+	}
+	value, hasValue := op["value"]
+	if !hasValue && (name == "add" || name == "replace" || name == "test") {
+		return nil, makeError("The %v operation must have a value", name)
+	}
+	switch name {
+	case "add":
+		return pointerAdd(doc, path, copyValue(value))
+	case "remove":
+		doc, _, err = pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err = pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, copyValue(value))
+	case "move", "copy":
+		return jsonPatchMoveCopy(doc, op, name, path)
+	case "test":
+		return jsonPatchTest(doc, path, value)
+	}
+	return nil, makeError("Unknown operation '%v'", name)
+}
+
+func jsonPatchMoveCopy(doc interface{}, op map[string]interface{}, name string, path []string) (interface{}, error) {
+	from, err := pointerField(op, "from")
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if name == "move" {
+		if len(from) < len(path) && isPointerPrefix(from, path) {
+			return nil, makeError("Cannot move a value into one of its children")
+		}
+		doc, value, err = pointerRemove(doc, from)
+	} else {
+		value, err = pointerGet(doc, from)
+		value = copyValue(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pointerAdd(doc, path, value)
+}
+
+func jsonPatchTest(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	actual, err := pointerGet(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	actualJSON, err := jsonMarshal(actual)
+	if err != nil {
+		return nil, err
+	}
+	valueJSON, err := jsonMarshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(actualJSON, valueJSON) {
+		return nil, makeError("The test failed for path '%v'", formatPointer(path))
+	}
+	return doc, nil
+}
+
+func pointerField(op map[string]interface{}, field string) ([]string, error) {
+	pointer, ok := op[field].(string)
+	if !ok {
+		return nil, makeError("The operation must have a '%v' string", field)
+	}
+	return parsePointer(pointer)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, makeError("The json pointer must start with a '/' : %v", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return b.String()
+}
+
+func isPointerPrefix(prefix []string, tokens []string) bool {
+	for i, token := range prefix {
+		if tokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
+
+func pointerItems(doc interface{}) ([]interface{}, bool) {
+	switch items := doc.(type) {
+	case []interface{}:
+		return items, true
+	case []map[string]interface{}:
+		return toSliceOfInterface(items), true
+	}
+	return nil, false
+}
+
+func pointerIndex(token string, length int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, makeError("The array index '%v' is not valid", token)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		if props, ok := doc.(map[string]interface{}); ok {
+			if doc, ok = props[token]; !ok {
+				return nil, makeError("The path '%v' does not exist", formatPointer(tokens))
+			}
+		} else if items, ok := pointerItems(doc); ok {
+			i, err := pointerIndex(token, len(items))
+			if err != nil {
+				return nil, err
+			}
+			doc = items[i]
+		} else {
+			return nil, makeError("The path '%v' does not exist", formatPointer(tokens))
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate replaces the parent of the value at the pointer tokens with the result of the update function
+func pointerUpdate(doc interface{}, tokens []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(doc, tokens[0])
+	}
+	child, err := pointerGet(doc, tokens[:1])
+	if err != nil {
+		return nil, makeError("The path '%v' does not exist", formatPointer(tokens))
+	}
+	child, err = pointerUpdate(child, tokens[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	if props, ok := doc.(map[string]interface{}); ok {
+		props[tokens[0]] = child
+		return props, nil
+	}
+	items, _ := pointerItems(doc)
+	i, _ := pointerIndex(tokens[0], len(items))
+	items[i] = child
+	return items, nil
+}
+
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		if props, ok := parent.(map[string]interface{}); ok {
+			props[token] = value
+			return props, nil
+		}
+		items, ok := pointerItems(parent)
+		if !ok {
+			return nil, makeError("The parent of path '%v' is not an object or array", formatPointer(tokens))
+		}
+		if token == "-" {
+			return append(items, value), nil
+		}
+		i, err := pointerIndex(token, len(items)+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items[:i], append([]interface{}{value}, items[i:]...)...)
+		return items, nil
+	})
+}
+
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	var removed interface{}
+	doc, err := pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		if props, ok := parent.(map[string]interface{}); ok {
+			value, ok := props[token]
+			if !ok {
+				return nil, makeError("The path '%v' does not exist", formatPointer(tokens))
+			}
+			removed = value
+			delete(props, token)
+			return props, nil
+		}
+		items, ok := pointerItems(parent)
+		if !ok {
+			return nil, makeError("The path '%v' does not exist", formatPointer(tokens))
+		}
+		i, err := pointerIndex(token, len(items))
+		if err != nil {
+			return nil, err
+		}
+		removed = items[i]
+		return append(items[:i:i], items[i+1:]...), nil
+	})
+	return doc, removed, err
+}
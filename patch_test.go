@@ -0,0 +1,104 @@
+package conflate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e", "f": "g"}, "h": []interface{}{1}}
+	patch := map[string]interface{}{"a": "z", "c": map[string]interface{}{"f": nil}, "h": []interface{}{2}, "i": map[string]interface{}{"j": nil, "k": 1}}
+	out := mergePatch(target, patch)
+	assert.Equal(t, map[string]interface{}{"a": "z", "c": map[string]interface{}{"d": "e"}, "h": []interface{}{2}, "i": map[string]interface{}{"k": 1}}, out)
+}
+
+func TestMergePatch_TargetUnchanged(t *testing.T) {
+	target := map[string]interface{}{"a": map[string]interface{}{"b": 1, "c": 2}}
+	out := mergePatch(target, map[string]interface{}{"a": map[string]interface{}{"b": nil}})
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"c": 2}}, out)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 1, "c": 2}}, target)
+}
+
+func TestMergePatch_NotObject(t *testing.T) {
+	assert.Equal(t, []interface{}{"x"}, mergePatch(map[string]interface{}{"a": 1}, []interface{}{"x"}))
+	assert.Equal(t, map[string]interface{}{"a": 1}, mergePatch("x", map[string]interface{}{"a": 1}))
+}
+
+func testJSONPatch(t *testing.T, target string, patch string) (interface{}, error) {
+	var doc interface{}
+	err := JSONUnmarshal([]byte(target), &doc)
+	assert.Nil(t, err)
+	var ops []interface{}
+	err = JSONUnmarshal([]byte(patch), &ops)
+	assert.Nil(t, err)
+	return jsonPatch(doc, ops)
+}
+
+func TestJSONPatch(t *testing.T) {
+	out, err := testJSONPatch(t, `{"a": {"b": [1, 2]}, "c": "d", "e~/f": 1}`, `[
+		{"op": "add", "path": "/a/b/1", "value": 3},
+		{"op": "add", "path": "/a/b/-", "value": 4},
+		{"op": "remove", "path": "/a/b/0"},
+		{"op": "replace", "path": "/c", "value": {"x": null}},
+		{"op": "copy", "from": "/a/b", "path": "/g"},
+		{"op": "move", "from": "/e~0~1f", "path": "/a/h"},
+		{"op": "test", "path": "/g", "value": [3, 2, 4]}
+	]`)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{int64(3), int64(2), int64(4)}, "h": int64(1)},
+		"c": map[string]interface{}{"x": nil},
+		"g": []interface{}{int64(3), int64(2), int64(4)},
+	}, out)
+}
+
+func TestJSONPatch_Root(t *testing.T) {
+	out, err := testJSONPatch(t, `{"a": 1}`, `[{"op": "replace", "path": "", "value": [1]}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1)}, out)
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	tests := map[string]string{
+		`[1]`:                           "The operation must be an object",
+		`[{"op": "add", "path": "/a"}]`: "The add operation must have a value",
+		`[{"op": "add", "path": "a", "value": 1}]`:                  "The json pointer must start with a '/'",
+		`[{"op": "add", "value": 1}]`:                               "The operation must have a 'path' string",
+		`[{"op": "bad", "path": "/a"}]`:                             "Unknown operation 'bad'",
+		`[{"op": "remove", "path": "/x"}]`:                          "The path '/x' does not exist",
+		`[{"op": "remove", "path": "/x/y"}]`:                        "The path '/x/y' does not exist",
+		`[{"op": "add", "path": "/b/01", "value": 1}]`:              "The array index '01' is not valid",
+		`[{"op": "add", "path": "/b/3", "value": 1}]`:               "The array index '3' is not valid",
+		`[{"op": "add", "path": "/a/x", "value": 1}]`:               "is not an object or array",
+		`[{"op": "move", "from": "/b", "path": "/b/0"}]`:            "Cannot move a value into one of its children",
+		`[{"op": "copy", "from": "/x", "path": "/y"}]`:              "The path '/x' does not exist",
+		`[{"op": "test", "path": "/a", "value": 2}]`:                "The test failed for path '/a'",
+		`[{"op": "add", "path": "/c", "value": 1}, {"op": "x"}]`:    "Failed to apply json patch operation 1",
+		`[{"op": "replace", "path": "/missing", "value": 1}]`:       "The path '/missing' does not exist",
+		`[{"op": "test", "path": "/b/1", "value": 2}, {"op": "x"}]`: "The operation must have a 'path' string",
+	}
+	for patch, msg := range tests {
+		_, err := testJSONPatch(t, `{"a": 1, "b": [1, 2]}`, patch)
+		assert.NotNil(t, err, patch)
+		if err != nil {
+			assert.Contains(t, err.Error(), msg, patch)
+		}
+	}
+}
+
+func TestJSONPatch_TargetUnchanged(t *testing.T) {
+	target := map[string]interface{}{"a": map[string]interface{}{"b": 1}}
+	_, err := jsonPatch(target, []interface{}{
+		map[string]interface{}{"op": "remove", "path": "/a/b"},
+		map[string]interface{}{"op": "remove", "path": "/x"},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 1}}, target)
+}
+
+func TestParsePointer(t *testing.T) {
+	tokens, err := parsePointer("/a~1b/~0c/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/b", "~c", ""}, tokens)
+	assert.Equal(t, "/a~1b/~0c/", formatPointer(tokens))
+}
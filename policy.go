@@ -0,0 +1,126 @@
+package conflate
+
+import (
+	"fmt"
+	"net/http"
+	pkgurl "net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IncludePolicy restricts the urls that can be included by data files, see WithIncludePolicy.
+// The urls passed to the Add and From functions are not restricted.
+type IncludePolicy struct {
+	// Schemes are the url schemes that can be included, e.g. "file" or "https". Any scheme is allowed if empty.
+	// Allowing "file" also allows the relative includes of files added with AddFS.
+	Schemes []string
+	// Hosts are the hosts of the http and https urls that can be included, as a host name, or host name and port, that may contain
+	// wildcards, e.g. "*.example.com". Any host is allowed if empty.
+	Hosts []string
+	// Roots are the directories containing the files that can be included, after resolving any '..' and symbolic links.
+	// Any file is allowed if empty. The includes of files added with AddFS are always within their file system, so are not restricted.
+	Roots []string
+}
+
+// IncludePolicyError is the error returned for an include, or a redirect, that is not allowed by the IncludePolicy
+type IncludePolicyError struct {
+	// Include is the url of the include, or the location a url was redirected to
+	Include string
+	// Parent is the url of the data file containing the include, or the url that was redirected, and is blank for data
+	Parent string
+	Reason string
+}
+
+func (e *IncludePolicyError) Error() string {
+	parent := e.Parent
+	if parent == "" {
+		parent = "<data>"
+	}
+	return fmt.Sprintf("The include %v of %v is not allowed : %v", e.Include, parent, e.Reason)
+}
+
+// check returns an IncludePolicyError if the url included by the parent is not allowed
+func (p *IncludePolicy) check(parent *pkgurl.URL, url pkgurl.URL) error {
+	if p == nil {
+		return nil
+	}
+	reason := p.reason(url)
+	if reason == "" {
+		return nil
+	}
+	err := &IncludePolicyError{Include: url.Redacted(), Reason: reason}
+	if parent != nil {
+		err.Parent = parent.Redacted()
+	}
+	return err
+}
+
+func (p *IncludePolicy) reason(url pkgurl.URL) string {
+	scheme := url.Scheme
+	if scheme == fsScheme {
+		scheme = "file"
+	}
+	if len(p.Schemes) > 0 && !containsFold(p.Schemes, scheme) {
+		return fmt.Sprintf("the scheme %v is not one of %v", url.Scheme, strings.Join(p.Schemes, ", "))
+	}
+	if url.Scheme == "file" && len(p.Roots) > 0 && !p.inRoots(getPath(url.Path)) {
+		return fmt.Sprintf("the file is not within %v", strings.Join(p.Roots, ", "))
+	}
+	if (url.Scheme == "http" || url.Scheme == "https") && len(p.Hosts) > 0 && !matchesHost(p.Hosts, url) {
+		return fmt.Sprintf("the host %v is not one of %v", url.Host, strings.Join(p.Hosts, ", "))
+	}
+	return ""
+}
+
+func (p *IncludePolicy) inRoots(file string) bool {
+	file = evalSymlinks(file)
+	for _, root := range p.Roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(evalSymlinks(root), file)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect refuses redirects to urls that are not allowed
+func (p *IncludePolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return makeError("Stopped after 10 redirects")
+	}
+	return p.check(via[len(via)-1].URL, *req.URL)
+}
+
+func evalSymlinks(file string) string {
+	file = filepath.Clean(file)
+	if resolved, err := filepath.EvalSymlinks(file); err == nil {
+		return resolved
+	}
+	return file
+}
+
+func matchesHost(patterns []string, url pkgurl.URL) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, host := range []string{strings.ToLower(url.Host), strings.ToLower(url.Hostname())} {
+			if ok, err := path.Match(pattern, host); ok && err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(items []string, search string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, search) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPolicyError(t *testing.T, err error) *IncludePolicyError {
+	var policyErr *IncludePolicyError
+	assert.True(t, errors.As(err, &policyErr), "%v", err)
+	return policyErr
+}
+
+func TestIncludePolicy_Schemes(t *testing.T) {
+	c := New(WithIncludePolicy(IncludePolicy{Schemes: []string{"file"}}))
+	err := c.AddData([]byte(`{"includes": ["testdata/valid_child.json", "http://169.254.169.254/latest/meta-data"]}`))
+	policyErr := testPolicyError(t, err)
+	assert.Equal(t, "http://169.254.169.254/latest/meta-data", policyErr.Include)
+	assert.Equal(t, "", policyErr.Parent)
+	assert.Equal(t, "The include http://169.254.169.254/latest/meta-data of <data> is not allowed : the scheme http is not one of file", err.Error())
+}
+
+func TestIncludePolicy_Hosts(t *testing.T) {
+	policy := &IncludePolicy{Hosts: []string{"*.example.com", "localhost:8080"}}
+	parent := &url.URL{Scheme: "file", Path: "/config/parent.json"}
+	for include, allowed := range map[string]bool{
+		"https://config.example.com/a.json": true,
+		"https://CONFIG.example.com:443/a":  true,
+		"https://example.com/a.json":        false,
+		"http://localhost:8080/a.json":      true,
+		"http://localhost:9090/a.json":      false,
+		"file:///etc/shadow":                true,
+		"fs://0/config/a.json":              true,
+		"mem://config/a.json":               true,
+	} {
+		u, err := url.Parse(include)
+		assert.Nil(t, err)
+		err = policy.check(parent, *u)
+		if allowed {
+			assert.Nil(t, err, include)
+		} else {
+			assert.Equal(t, "file:///config/parent.json", testPolicyError(t, err).Parent, include)
+		}
+	}
+}
+
+func TestIncludePolicy_Roots(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{"secret": true}`), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "sub", "child.json"), []byte(`{"child": true}`), 0644))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "secret.json"), filepath.Join(root, "link.json")))
+	for name, include := range map[string]string{"ok.json": "sub/child.json", "escape.json": "../secret.json", "link.json": "link.json", "absolute.json": filepath.Join(dir, "secret.json")} {
+		data := fmt.Sprintf(`{"includes": [%q]}`, include)
+		assert.Nil(t, os.WriteFile(filepath.Join(root, name), []byte(data), 0644))
+	}
+	options := WithIncludePolicy(IncludePolicy{Roots: []string{root}})
+
+	c := New(options)
+	assert.Nil(t, c.AddFiles(filepath.Join(root, "ok.json")))
+	assert.Equal(t, map[string]interface{}{"child": true}, c.data)
+	for _, name := range []string{"escape.json", "absolute.json"} {
+		err := New(options).AddFiles(filepath.Join(root, name))
+		policyErr := testPolicyError(t, err)
+		assert.Contains(t, policyErr.Include, "/secret.json")
+		assert.Contains(t, policyErr.Parent, "/root/"+name)
+		assert.Contains(t, policyErr.Reason, "the file is not within "+root)
+	}
+	err := New(options).AddFiles(filepath.Join(root, "link.json"))
+	assert.Contains(t, testPolicyError(t, err).Include, "/root/link.json")
+}
+
+func TestIncludePolicy_Redirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/internal.json", http.StatusFound)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+
+	c := New(WithIncludePolicy(IncludePolicy{Hosts: []string{serverURL.Host}}))
+	err = c.AddData([]byte(fmt.Sprintf(`{"includes": ["%v/config.json"]}`, server.URL)))
+	policyErr := testPolicyError(t, err)
+	assert.Equal(t, target.URL+"/internal.json", policyErr.Include)
+	assert.Equal(t, server.URL+"/config.json", policyErr.Parent)
+
+	c = New(WithIncludePolicy(IncludePolicy{Hosts: []string{serverURL.Hostname()}}))
+	err = c.AddData([]byte(fmt.Sprintf(`{"includes": ["%v/config.json"]}`, server.URL)))
+	assert.Nil(t, err)
+}
+
+func TestIncludePolicy_AddFS(t *testing.T) {
+	for _, policy := range []IncludePolicy{
+		{Hosts: []string{"example.com"}},
+		{Schemes: []string{"file"}},
+		{Roots: []string{"./user"}},
+	} {
+		c := New(WithIncludePolicy(policy))
+		err := c.AddFS(testFS, "config/parent.json")
+		assert.Nil(t, err, "%v", policy)
+		assert.Equal(t, map[string]interface{}{"parent": true, "child": true, "sibling": true}, c.data)
+	}
+
+	c := New(WithIncludePolicy(IncludePolicy{Schemes: []string{"https"}}))
+	err := c.AddFS(testFS, "config/parent.json")
+	assert.Equal(t, "the scheme fs is not one of https", testPolicyError(t, err).Reason)
+}
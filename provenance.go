@@ -0,0 +1,190 @@
+package conflate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Source identifies the data that set a value. The URL is blank for data that was not loaded from a URL, and the Line and Column are zero when the position of the value is unknown.
+type Source struct {
+	URL    string
+	Line   int
+	Column int
+}
+
+func (s Source) String() string {
+	url := s.URL
+	if url == "" {
+		url = "<data>"
+	}
+	if s.Line == 0 {
+		return url
+	}
+	return fmt.Sprintf("%v:%v:%v", url, s.Line, s.Column)
+}
+
+type provenance map[context][]Source
+
+func (p provenance) add(ctx context, source Source) {
+	if p != nil {
+		p[ctx] = append(p[ctx], source)
+	}
+}
+
+// get returns the sources of the value at the context, or for values inside arrays of the nearest ancestor with any sources
+func (p provenance) get(ctx context) []Source {
+	for {
+		if sources, ok := p[ctx]; ok || !strings.Contains(ctx.String(), "[") {
+			return sources
+		}
+		ctx = ctx.parent()
+	}
+}
+
+// sourceMap locates the values of a single filedata
+type sourceMap struct {
+	url       string
+	positions map[context]Source
+}
+
+func newSourceMap(fd filedata) *sourceMap {
+	sm := &sourceMap{}
+	if fd.url != emptyURL {
+		sm.url = fd.url.Redacted()
+	}
+	ext := strings.ToLower(filepath.Ext(fd.url.Path))
+	if ext == ".json" || ext == ".jsn" || (ext == "" && bytes.HasPrefix(bytes.TrimSpace(fd.data), []byte("{"))) {
+		sm.positions = jsonPositions(fd.data)
+	}
+	if len(fd.at) > 0 {
+		sm.positions = mountPositions(rootContext().add(fd.at...), sm.positions)
+	}
+	return sm
+}
+
+// mountPositions moves the positions of data merged under a mount point, see include
+func mountPositions(mount context, positions map[context]Source) map[context]Source {
+	mounted := make(map[context]Source, len(positions))
+	for ctx, source := range positions {
+		mounted[context(mount.String()+strings.TrimPrefix(ctx.String(), rootContext().String()))] = source
+	}
+	return mounted
+}
+
+func (sm *sourceMap) at(ctx context) Source {
+	if sm == nil {
+		return Source{}
+	}
+	if source, ok := sm.positions[ctx]; ok {
+		source.URL = sm.url
+		return source
+	}
+	return Source{URL: sm.url}
+}
+
+// jsonPositions finds the line and column of each object value in the json data. Arrays are not descended into.
+func jsonPositions(data []byte) map[context]Source {
+	positions := make(map[context]Source)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var walk func(ctx context) error
+	walk = func(ctx context) error {
+		positions[ctx] = offsetPosition(data, dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				err = walk(ctx.add(fmt.Sprint(key)))
+				if err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for dec.More() {
+				var item json.RawMessage
+				if err = dec.Decode(&item); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+	_ = walk(rootContext())
+	return positions
+}
+
+func offsetPosition(data []byte, offset int64) Source {
+	for int(offset) < len(data) && strings.ContainsRune(" \t\r\n:,", rune(data[offset])) {
+		offset++
+	}
+	prefix := data[:offset]
+	line := bytes.Count(prefix, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(prefix, '\n')
+	return Source{Line: line, Column: column}
+}
+
+// addValue records the source of the value at the context, and of any object values nested within it
+func (p provenance) addValue(ctx context, sm *sourceMap, data interface{}) {
+	if p == nil {
+		return
+	}
+	p.add(ctx, sm.at(ctx))
+	if props, ok := data.(map[string]interface{}); ok {
+		for name, prop := range props {
+			p.addValue(ctx.add(name), sm, prop)
+		}
+	}
+}
+
+// recordAt records the source being merged as the source of the value at the context, and the merge as its owner so
+// that conflicts are detected between merges rather than between urls
+func (m *merger) recordAt(ctx context) {
+	m.provenance.add(ctx, m.source.at(ctx))
+	if m.owners == nil {
+		m.owners = make(map[context]*sourceMap)
+	}
+	m.owners[ctx] = m.source
+}
+
+// record records the source being merged as the source of the value at the context, and of any values nested within it
+// in objects, or in arrays that are merged by key
+func (m *merger) record(ctx context, data interface{}) {
+	m.recordAt(ctx)
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for name, prop := range data {
+			m.record(ctx.add(name), prop)
+		}
+	case []interface{}:
+		if m.arrayMergeKeyAt(ctx) != "" {
+			for i, item := range data {
+				m.record(ctx.addInt(i), item)
+			}
+		}
+	}
+}
+
+// addPointer records the source of a json patch operation at the pointer, or at the array containing it
+func (p provenance) addPointer(sm *sourceMap, doc interface{}, tokens []string) {
+	ctx := rootContext()
+	for _, token := range tokens {
+		props, ok := doc.(map[string]interface{})
+		if !ok {
+			break
+		}
+		ctx = ctx.add(token)
+		doc = props[token]
+	}
+	p.add(ctx, sm.at(ctx))
+}
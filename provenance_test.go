@@ -0,0 +1,67 @@
+package conflate
+
+import (
+	"github.com/stretchr/testify/assert"
+	pkgurl "net/url"
+	"testing"
+)
+
+func TestSource_String(t *testing.T) {
+	assert.Equal(t, "<data>", Source{}.String())
+	assert.Equal(t, "file.json", Source{URL: "file.json"}.String())
+	assert.Equal(t, "file.json:2:3", Source{URL: "file.json", Line: 2, Column: 3}.String())
+}
+
+func TestJSONPositions(t *testing.T) {
+	positions := jsonPositions([]byte(`{
+  "a": 1,
+  "b": {"c": [{"d": 1}], "e" : "x"}
+}`))
+	assert.Equal(t, map[context]Source{
+		"#":     {Line: 1, Column: 1},
+		"#/a":   {Line: 2, Column: 8},
+		"#/b":   {Line: 3, Column: 8},
+		"#/b/c": {Line: 3, Column: 14},
+		"#/b/e": {Line: 3, Column: 32},
+	}, positions)
+}
+
+func TestJSONPositions_Invalid(t *testing.T) {
+	positions := jsonPositions([]byte(`{"a": 1, "b": `))
+	assert.Equal(t, Source{Line: 1, Column: 7}, positions["#/a"])
+}
+
+func TestSourceMap(t *testing.T) {
+	url, err := pkgurl.Parse("file.json")
+	assert.Nil(t, err)
+	sm := newSourceMap(filedata{url: *url, data: []byte(`{"a": 1}`)})
+	assert.Equal(t, Source{URL: "file.json", Line: 1, Column: 7}, sm.at("#/a"))
+	assert.Equal(t, Source{URL: "file.json"}, sm.at("#/b"))
+	url, err = pkgurl.Parse("file.yaml")
+	assert.Nil(t, err)
+	sm = newSourceMap(filedata{url: *url, data: []byte(`a: 1`)})
+	assert.Equal(t, Source{URL: "file.yaml"}, sm.at("#/a"))
+	assert.Equal(t, Source{}, (*sourceMap)(nil).at("#/a"))
+}
+
+func TestProvenance_Get(t *testing.T) {
+	p := provenance{"#/a": {{URL: "x"}}, "#/a/b": {{URL: "y"}}}
+	assert.Equal(t, []Source{{URL: "y"}}, p.get("#/a/b"))
+	assert.Equal(t, []Source{{URL: "x"}}, p.get("#/a[1]/d"))
+	assert.Nil(t, p.get("#/a/z"))
+}
+
+func TestMerge_Provenance(t *testing.T) {
+	m := merger{provenance: make(provenance)}
+	var toData interface{}
+	m.source = &sourceMap{url: "one"}
+	err := m.merge(&toData, map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 1}, "d": []interface{}{1}})
+	assert.Nil(t, err)
+	m.source = &sourceMap{url: "two"}
+	err = m.merge(&toData, map[string]interface{}{"a": 2, "b": map[string]interface{}{"$delete": true}, "d": []interface{}{2}})
+	assert.Nil(t, err)
+	assert.Equal(t, []Source{{URL: "one"}, {URL: "two"}}, m.provenance.get("#/a"))
+	assert.Equal(t, []Source{{URL: "one"}, {URL: "two"}}, m.provenance.get("#/b"))
+	assert.Equal(t, []Source{{URL: "one"}}, m.provenance.get("#/b/c"))
+	assert.Equal(t, []Source{{URL: "one"}, {URL: "two"}}, m.provenance.get("#/d[1]"))
+}
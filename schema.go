@@ -1,11 +1,13 @@
 package conflate
 
 import (
+	gocontext "context"
 	"fmt"
 	"math"
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/xeipuuv/gojsonreference"
 	"github.com/xeipuuv/gojsonschema"
@@ -25,18 +27,28 @@ type Schema struct {
 
 // NewSchemaFile loads a JSON v4 schema from the given path
 func NewSchemaFile(path string) (*Schema, error) {
+	return NewSchemaFileContext(gocontext.Background(), path)
+}
+
+// NewSchemaFileContext loads a JSON v4 schema from the given path with the context
+func NewSchemaFileContext(ctx gocontext.Context, path string) (*Schema, error) {
 	url, err := toURL(nil, path)
 	if err != nil {
 		return nil, wrapError(err, "Failed to obtain url to schema file")
 	}
-	return NewSchemaURL(url)
+	return NewSchemaURLContext(ctx, url)
 }
 
 // NewSchemaURL loads a JSON v4 schema from the given URL
 func NewSchemaURL(url url.URL) (*Schema, error) {
-	data, err := loadURL(url)
+	return NewSchemaURLContext(gocontext.Background(), url)
+}
+
+// NewSchemaURLContext loads a JSON v4 schema from the given URL with the context
+func NewSchemaURLContext(ctx gocontext.Context, url url.URL) (*Schema, error) {
+	data, err := loadURL(ctx, url)
 	if err != nil {
-		return nil, wrapError(err, "Failed to load schema url %v", url)
+		return nil, wrapError(err, "Failed to load schema url %v", url.Redacted())
 	}
 	return NewSchemaData(data)
 }
@@ -77,6 +89,47 @@ func (s *Schema) ApplyDefaults(pData interface{}) error {
 	return applyDefaults(pData, s.s)
 }
 
+// typeAt returns the type defined in the schema for the value at the context, or blank if there is no single type
+func (s *Schema) typeAt(ctx context) string {
+	node := resolveSchemaRef(s.s, s.s)
+	for _, part := range strings.Split(ctx.String(), "/")[1:] {
+		name := arrayIndex.ReplaceAllString(part, "")
+		node = resolveSchemaRef(s.s, schemaProperty(node, name))
+		for range arrayIndex.FindAllString(part, -1) {
+			node = resolveSchemaRef(s.s, node["items"])
+		}
+	}
+	schemaType, _ := node["type"].(string)
+	return schemaType
+}
+
+func schemaProperty(node map[string]interface{}, name string) interface{} {
+	if props, ok := node["properties"].(map[string]interface{}); ok {
+		if prop, ok := props[name]; ok {
+			return prop
+		}
+	}
+	return node["additionalProperties"]
+}
+
+func resolveSchemaRef(rootSchema interface{}, schema interface{}) map[string]interface{} {
+	node, _ := schema.(map[string]interface{})
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+	jref, err := gojsonreference.NewJsonReference(ref)
+	if err != nil {
+		return nil
+	}
+	subSchema, _, err := jref.GetPointer().Get(rootSchema)
+	if err != nil {
+		return nil
+	}
+	node, _ = subSchema.(map[string]interface{})
+	return node
+}
+
 var metaSchema interface{}
 
 func updateMetaSchema(s interface{}) (draft string, err error) {
@@ -121,7 +174,12 @@ func validateSchema(schema interface{}) (string, error) {
 	return draft, validate(schema, metaSchema)
 }
 
+// validateMutex serialises validation, as the format checkers record their errors in formatErrs
+var validateMutex sync.Mutex
+
 func validate(data interface{}, schema interface{}) error {
+	validateMutex.Lock()
+	defer validateMutex.Unlock()
 	dataLoader := gojsonschema.NewGoLoader(data)
 	schemaLoader := gojsonschema.NewGoLoader(schema)
 	formatErrs.clear()
@@ -1,11 +1,21 @@
 package conflate
 
 import (
+	gocontext "context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+func TestSchema_NewSchemaFileContextCancelled(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	_, err := NewSchemaFileContext(ctx, "testdata/test.schema.json")
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, gocontext.Canceled))
+}
+
 func TestSchema_NewSchemaBadUrl(t *testing.T) {
 	_, err := NewSchemaFile(`!"£$%^&*()`)
 	assert.NotNil(t, err)
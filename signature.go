@@ -0,0 +1,67 @@
+package conflate
+
+import (
+	gocontext "context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	pkgurl "net/url"
+	"strings"
+)
+
+// SignatureSuffix is the suffix added to the url of a file to load its detached ed25519 signature, see WithTrustedKeys
+var SignatureSuffix = ".sig"
+
+// SignatureError is the error returned when the data loaded from a url does not have a valid signature from a trusted key
+type SignatureError struct {
+	URL    string
+	Reason string
+	// Err is the error loading the signature, if any
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("The signature of %v is not valid : %v : %v", e.URL, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("The signature of %v is not valid : %v", e.URL, e.Reason)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// verifySignature checks the data loaded from the url against its signature, when there are trusted keys
+func (l *loader) verifySignature(ctx gocontext.Context, url pkgurl.URL, data []byte) error {
+	if len(l.trustedKeys) == 0 {
+		return nil
+	}
+	sigURL := url
+	sigURL.Path, sigURL.RawPath = url.Path+SignatureSuffix, ""
+	b, err := l.loadURL(ctx, sigURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &SignatureError{URL: url.Redacted(), Reason: "the signature could not be loaded", Err: err}
+	}
+	sig, ok := decodeSignature(b)
+	if !ok {
+		return &SignatureError{URL: url.Redacted(), Reason: "the signature is not an ed25519 signature"}
+	}
+	for _, key := range l.trustedKeys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return &SignatureError{URL: url.Redacted(), Reason: "the signature is not from a trusted key"}
+}
+
+// decodeSignature accepts a raw signature, or a base64 encoded signature
+func decodeSignature(b []byte) ([]byte, bool) {
+	if len(b) == ed25519.SignatureSize {
+		return b, true
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	return sig, err == nil && len(sig) == ed25519.SignatureSize
+}
@@ -0,0 +1,135 @@
+package conflate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSignedDir(t *testing.T, key ed25519.PrivateKey, files map[string]string) string {
+	dir := testGlobDir(t, files)
+	for name, content := range files {
+		sig := ed25519.Sign(key, []byte(content))
+		err := ioutil.WriteFile(filepath.Join(dir, name+".sig"), sig, 0o644)
+		assert.Nil(t, err)
+	}
+	return dir
+}
+
+func testSignatureError(t *testing.T, err error) *SignatureError {
+	var sigErr *SignatureError
+	assert.True(t, errors.As(err, &sigErr), "%v", err)
+	return sigErr
+}
+
+func testKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	return public, private
+}
+
+func TestWithTrustedKeys(t *testing.T) {
+	public, private := testKey(t)
+	other, _ := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{
+		"main.yaml":  "includes: [child.yaml]\nx: main\n",
+		"child.yaml": "z: child\n",
+	})
+	c := New(WithTrustedKeys(other, public))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": "main", "z": "child"}, data)
+}
+
+func TestWithTrustedKeys_Base64(t *testing.T) {
+	public, private := testKey(t)
+	dir := testGlobDir(t, map[string]string{"main.yaml": "x: 1\n"})
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("x: 1\n")))
+	err := ioutil.WriteFile(filepath.Join(dir, "main.yaml.sig"), []byte(sig+"\n"), 0o644)
+	assert.Nil(t, err)
+	c := New(WithTrustedKeys(public))
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	assert.Nil(t, err)
+}
+
+func TestWithTrustedKeys_Unsigned(t *testing.T) {
+	public, private := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{"main.yaml": "includes: [child.yaml]\n"})
+	err := ioutil.WriteFile(filepath.Join(dir, "child.yaml"), []byte("z: child\n"), 0o644)
+	assert.Nil(t, err)
+	c := New(WithTrustedKeys(public))
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	sigErr := testSignatureError(t, err)
+	assert.Contains(t, sigErr.URL, "child.yaml")
+	assert.Equal(t, "the signature could not be loaded", sigErr.Reason)
+	assert.NotNil(t, sigErr.Err)
+	assert.Nil(t, c.data)
+}
+
+func TestWithTrustedKeys_Untrusted(t *testing.T) {
+	public, _ := testKey(t)
+	_, private := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{"main.yaml": "x: 1\n"})
+	c := New(WithTrustedKeys(public))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	sigErr := testSignatureError(t, err)
+	assert.Equal(t, "the signature is not from a trusted key", sigErr.Reason)
+	assert.Contains(t, err.Error(), "The signature of file://")
+}
+
+func TestWithTrustedKeys_Tampered(t *testing.T) {
+	public, private := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{"main.yaml": "x: 1\n"})
+	err := ioutil.WriteFile(filepath.Join(dir, "main.yaml"), []byte("x: 2\n"), 0o644)
+	assert.Nil(t, err)
+	c := New(WithTrustedKeys(public))
+	err = c.AddFiles(filepath.Join(dir, "main.yaml"))
+	sigErr := testSignatureError(t, err)
+	assert.Equal(t, "the signature is not from a trusted key", sigErr.Reason)
+}
+
+func TestWithTrustedKeys_Malformed(t *testing.T) {
+	public, _ := testKey(t)
+	dir := testGlobDir(t, map[string]string{"main.yaml": "x: 1\n", "main.yaml.sig": "not a signature"})
+	c := New(WithTrustedKeys(public))
+	err := c.AddFiles(filepath.Join(dir, "main.yaml"))
+	sigErr := testSignatureError(t, err)
+	assert.Equal(t, "the signature is not an ed25519 signature", sigErr.Reason)
+}
+
+func TestWithTrustedKeys_OptionalUnsigned(t *testing.T) {
+	public, private := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{"a.json": `{"includes": [{"path": "b.json", "optional": true}, {"path": "missing.json", "optional": true}]}`})
+	err := ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"b": 1}`), 0o644)
+	assert.Nil(t, err)
+	c := New(WithTrustedKeys(public))
+	err = c.AddFiles(filepath.Join(dir, "a.json"))
+	sigErr := testSignatureError(t, err)
+	assert.Contains(t, sigErr.URL, "b.json")
+	assert.Equal(t, "the signature could not be loaded", sigErr.Reason)
+}
+
+func TestWithTrustedKeys_UnsignedPatch(t *testing.T) {
+	public, private := testKey(t)
+	dir := testSignedDir(t, private, map[string]string{"main.json": `{"a": 1}`, "signed.merge-patch.json": `{"b": 1}`})
+	err := ioutil.WriteFile(filepath.Join(dir, "p.merge-patch.json"), []byte(`{"a": 2}`), 0o644)
+	assert.Nil(t, err)
+	c := New(WithTrustedKeys(public))
+	err = c.AddFiles(filepath.Join(dir, "main.json"))
+	assert.Nil(t, err)
+	err = c.ApplyPatchFiles(filepath.Join(dir, "signed.merge-patch.json"))
+	assert.Nil(t, err)
+	err = c.ApplyPatchFiles(filepath.Join(dir, "p.merge-patch.json"))
+	sigErr := testSignatureError(t, err)
+	assert.Contains(t, sigErr.URL, "p.merge-patch.json")
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": int64(1)}, c.data)
+}